@@ -0,0 +1,3 @@
+output "first_server" {
+  value = provider::k3d::container_name("mycluster", "server", 0)
+}
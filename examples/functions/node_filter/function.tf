@@ -0,0 +1,11 @@
+resource "k3d_cluster" "mycluster" {
+  name    = "mycluster"
+  servers = 1
+  agents  = 2
+
+  label {
+    key          = "foo"
+    value        = "bar"
+    node_filters = [provider::k3d::node_filter("agent", "*")]
+  }
+}
@@ -0,0 +1,20 @@
+resource "k3d_cluster" "mycluster" {
+  name   = "mycluster"
+  agents = 2
+
+  dynamic "port" {
+    for_each = concat(
+      provider::k3d::parse_port_mapping("8080:80@loadbalancer"),
+      # the node filters are checked against the counts of the cluster
+      provider::k3d::parse_port_mapping("5353:53/udp@agent:0,1:direct", { servers = 1, agents = 2 }),
+    )
+
+    content {
+      host           = port.value.host
+      host_port      = port.value.host_port
+      container_port = port.value.container_port
+      protocol       = port.value.protocol
+      node_filters   = port.value.node_filters
+    }
+  }
+}
@@ -1,3 +1,4 @@
 provider "k3d" {
-  # example configuration here
+  # keep the complete logs of the nodes failing to start, e.g. as CI artifacts
+  node_logs_dir = "${path.root}/k3d-logs"
 }
@@ -64,9 +64,50 @@ mirrors:
 EOF
   }
 
+  host_alias {
+    ip        = "192.168.1.10"
+    hostnames = ["my-service.local"]
+  }
+
+  file {
+    source       = "/my/host/ca-bundle.crt"
+    destination  = "/etc/ssl/certs/my-ca-bundle.crt"
+    node_filters = ["all"]
+  }
+
+  manifest {
+    name    = "my-namespace"
+    content = <<EOF
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-namespace
+EOF
+  }
+
+  helm_chart {
+    name             = "ingress-nginx"
+    repo             = "https://kubernetes.github.io/ingress-nginx"
+    chart            = "ingress-nginx"
+    version          = "4.7.1"
+    target_namespace = "ingress-nginx"
+    values           = <<EOF
+controller:
+  replicaCount: 2
+EOF
+  }
+
   k3d {
     disable_load_balancer = false
     disable_image_volume  = false
+
+    load_balancer {
+      worker_connections    = 2048
+      default_proxy_timeout = 900
+      labels = {
+        "my.label" = "value"
+      }
+    }
   }
 
   k3s {
@@ -79,6 +120,8 @@ EOF
   kubeconfig {
     update_default_kubeconfig = true
     switch_current_context    = true
+    context_name              = "mycluster"
+    server_host               = "host.docker.internal"
   }
 
   runtime {
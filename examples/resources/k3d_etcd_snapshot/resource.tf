@@ -0,0 +1,13 @@
+resource "k3d_etcd_snapshot" "mysnapshot" {
+  cluster   = "mycluster"
+  name      = "before-upgrade"
+  host_path = "/my/host/backups"
+}
+
+resource "k3d_cluster" "restored" {
+  name    = "restored"
+  servers = 3
+  token   = "superSecretToken"
+
+  restore_from_snapshot = k3d_etcd_snapshot.mysnapshot.path
+}
@@ -0,0 +1,2 @@
+# Network can be imported using its name
+terraform import k3d_network.mynetwork my-network
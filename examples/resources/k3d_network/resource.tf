@@ -0,0 +1,14 @@
+resource "k3d_network" "mynetwork" {
+  name   = "my-network"
+  subnet = "172.28.0.0/16"
+}
+
+resource "k3d_registry" "myregistry" {
+  name    = "myregistry"
+  network = k3d_network.mynetwork.name
+}
+
+resource "k3d_cluster" "mycluster" {
+  name    = "mycluster"
+  network = k3d_network.mynetwork.name
+}
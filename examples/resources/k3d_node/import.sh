@@ -0,0 +1,2 @@
+# Node can be imported using the name of its container
+terraform import k3d_node.mynode k3d-mynode
@@ -5,4 +5,37 @@ resource "k3d_node" "mynode" {
   image   = "rancher/k3s:v1.20.4-k3s1"
   memory  = "512M"
   role    = "agent"
-}
\ No newline at end of file
+
+  env {
+    key   = "HTTP_PROXY"
+    value = "http://proxy.my.domain:3128"
+  }
+
+  volume {
+    source      = "/my/host/path"
+    destination = "/path/in/node"
+  }
+
+  port {
+    host_port      = 8080
+    container_port = 80
+  }
+
+  k3s_extra_args = [
+    "--node-taint=dedicated=gpu:NoSchedule",
+  ]
+
+  k3s_node_labels = {
+    "node.kubernetes.io/pool" = "gpu"
+  }
+
+  runtime_labels = {
+    "my.company/owner" = "platform"
+  }
+
+  networks = [
+    "my-other-net",
+  ]
+
+  restart_policy = "unless-stopped"
+}
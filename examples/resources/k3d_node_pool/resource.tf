@@ -0,0 +1,13 @@
+resource "k3d_node_pool" "mypool" {
+  name     = "mypool"
+  replicas = 5
+
+  cluster = "mycluster"
+  image   = "rancher/k3s:v1.20.4-k3s1"
+  memory  = "512M"
+  role    = "agent"
+
+  k3s_node_labels = {
+    "node.kubernetes.io/pool" = "mypool"
+  }
+}
@@ -0,0 +1,2 @@
+# Volume can be imported using its name
+terraform import k3d_volume.myvolume my-registry-data
@@ -0,0 +1,15 @@
+resource "k3d_volume" "myvolume" {
+  name = "my-registry-data"
+  labels = {
+    "my.label" = "value"
+  }
+}
+
+resource "k3d_registry" "myregistry" {
+  name = "myregistry"
+
+  volume = [{
+    source      = k3d_volume.myvolume.name
+    destination = "/var/lib/registry"
+  }]
+}
@@ -5,13 +5,13 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/k3d-io/k3d/v5/pkg/client"
-	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
@@ -51,20 +51,28 @@ func dataSourceCluster() *schema.Resource {
 
 func dataSourceClusterRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	clusterName := d.Get("name").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 	d.SetId(clusterName)
 
-	cluster, err := client.ClusterGet(ctx, runtimes.SelectedRuntime, &types.Cluster{Name: clusterName})
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	if err := d.Set("network", cluster.Network.Name); err != nil {
 		return diag.FromErr(err)
 	}
-	if err := d.Set("token", cluster.Token); err != nil {
+	token, err := getClusterToken(ctx, runtime, cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("token", token); err != nil {
 		return diag.FromErr(err)
 	}
 
-	k, err := client.KubeconfigGet(ctx, runtimes.SelectedRuntime, cluster)
+	k, err := client.KubeconfigGet(ctx, runtime, cluster)
 	if err == nil {
 		r, err := clientcmd.Write(*k)
 		if err == nil {
@@ -1,33 +1,37 @@
 package provider
 
 import (
-	"regexp"
+	"fmt"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 )
 
 func TestAccDataSourceCluster(t *testing.T) {
 	//t.Skip("data source not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccDataSourceCluster,
+				Config: testAccDataSourceCluster(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"data.k3d_cluster.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"data.k3d_cluster.foo", "name", name),
 				),
 			},
 		},
 	})
 }
 
-const testAccDataSourceCluster = `
+func testAccDataSourceCluster(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_cluster" "foo" {
-  name = "bar"
+  name = %[1]q
 }
 
 data "k3d_cluster" "foo" {
@@ -35,4 +39,5 @@ data "k3d_cluster" "foo" {
 
   name = k3d_cluster.foo.name
 }
-`
+`, name)
+}
@@ -2,13 +2,12 @@ package provider
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 
 	"github.com/k3d-io/k3d/v5/pkg/client"
-	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
@@ -21,10 +20,15 @@ func dataSourceNode() *schema.Resource {
 
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Description: "Node name.",
+				Description: "Node name, with or without the `k3d-` prefix.",
 				Required:    true,
 				Type:        schema.TypeString,
 			},
+			"container_name": {
+				Description: "Name of the node container.",
+				Computed:    true,
+				Type:        schema.TypeString,
+			},
 			"cluster": {
 				Description: "Select the cluster that the node shall connect to.",
 				Computed:    true,
@@ -40,16 +44,22 @@ func dataSourceNode() *schema.Resource {
 }
 
 func dataSourceNodeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	nodeName := d.Get("name").(string)
-	nodeID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, nodeName)
+	nodeID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node", nodeID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 	d.SetId(nodeID)
 
-	node, err := client.NodeGet(ctx, runtimes.SelectedRuntime, &types.Node{Name: nodeID})
+	node, err := client.NodeGet(ctx, runtime, &types.Node{Name: nodeID})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	if err := d.Set("cluster", node.K3sNodeLabels[types.LabelClusterName]); err != nil {
+	if err := d.Set("container_name", node.Name); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("cluster", node.RuntimeLabels[types.LabelClusterName]); err != nil {
 		return diag.FromErr(err)
 	}
 	if err := d.Set("role", string(node.Role)); err != nil {
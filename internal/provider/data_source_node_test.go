@@ -1,37 +1,41 @@
 package provider
 
 import (
-	"regexp"
+	"fmt"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 )
 
 func TestAccDataSourceNode(t *testing.T) {
 	//t.Skip("data source not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccDataSourceNode,
+				Config: testAccDataSourceNode(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"data.k3d_node.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"data.k3d_node.foo", "name", name),
 				),
 			},
 		},
 	})
 }
 
-const testAccDataSourceNode = `
+func testAccDataSourceNode(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_cluster" "foo" {
-  name = "bar"
+  name = %[1]q
 }
 
 resource "k3d_node" "foo" {
-  name    = "bar"
+  name    = %[1]q
   cluster = k3d_cluster.foo.name
 }
 
@@ -40,4 +44,5 @@ data "k3d_node" "foo" {
 
   name = k3d_node.foo.name
 }
-`
+`, name)
+}
@@ -2,42 +2,81 @@ package provider
 
 import (
 	"context"
-	"fmt"
 
-	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 
 	"github.com/k3d-io/k3d/v5/pkg/client"
-	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
-func dataSourceRegistry() *schema.Resource {
-	return &schema.Resource{
-		// This description is used by the documentation generator and the language server.
-		Description: "k3d-managed registry.",
+var _ datasource.DataSourceWithConfigure = &registryDataSource{}
+
+func newRegistryDataSource() datasource.DataSource {
+	return &registryDataSource{}
+}
+
+type registryDataSource struct {
+	client *apiClient
+}
+
+type registryDataSourceModel struct {
+	ID            fwtypes.String `tfsdk:"id"`
+	Name          fwtypes.String `tfsdk:"name"`
+	ContainerName fwtypes.String `tfsdk:"container_name"`
+}
+
+func (d *registryDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_registry"
+}
 
-		ReadContext: dataSourceRegistryRead,
+func (d *registryDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "k3d-managed registry.",
 
-		Schema: map[string]*schema.Schema{
-			"name": {
-				Description: "Registry name.",
-				Required:    true,
-				Type:        schema.TypeString,
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				MarkdownDescription: "The ID of this resource.",
+				Computed:            true,
+			},
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Registry name, with or without the `k3d-` prefix.",
+				Required:            true,
+			},
+			"container_name": schema.StringAttribute{
+				MarkdownDescription: "Name of the registry container.",
+				Computed:            true,
 			},
 		},
 	}
 }
 
-func dataSourceRegistryRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	registryName := d.Get("name").(string)
-	registryID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, registryName)
-	d.SetId(registryID)
+func (d *registryDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	d.client = configureClient(req.ProviderData, &resp.Diagnostics)
+}
+
+func (d *registryDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var config registryDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	registryID := containerName(config.Name.ValueString())
+	ctx = tflog.SetField(ctx, "registry", registryID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
 
-	_, err := client.NodeGet(ctx, runtimes.SelectedRuntime, &types.Node{Name: registryID})
+	registry, err := client.NodeGet(ctx, d.client.runtime, &types.Node{Name: registryID})
 	if err != nil {
-		return diag.FromErr(err)
+		resp.Diagnostics.AddError("Failed to read registry", err.Error())
+		return
 	}
 
-	return nil
+	config.ID = fwtypes.StringValue(registryID)
+	config.ContainerName = fwtypes.StringValue(registry.Name)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &config)...)
 }
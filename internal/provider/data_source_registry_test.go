@@ -1,33 +1,43 @@
 package provider
 
 import (
-	"regexp"
+	"context"
+	"fmt"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
 func TestAccDataSourceRegistry(t *testing.T) {
 	//t.Skip("data source not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccDataSourceRegistry,
+				Config: testAccDataSourceRegistry(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"data.k3d_registry.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"data.k3d_registry.foo", "name", name),
 				),
 			},
 		},
 	})
 }
 
-const testAccDataSourceRegistry = `
+func testAccDataSourceRegistry(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_registry" "foo" {
-  name = "bar"
+  name = %[1]q
 }
 
 data "k3d_registry" "foo" {
@@ -35,4 +45,45 @@ data "k3d_registry" "foo" {
 
   name = k3d_registry.foo.name
 }
-`
+`, name)
+}
+
+func TestDataSourceRegistry_fakeRuntime(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	if err := runtime.CreateNode(ctx, &types.Node{Name: "k3d-foo", Role: types.RegistryRole}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newRegistryDataSource()
+	var schemaResp datasource.SchemaResponse
+	d.Schema(ctx, datasource.SchemaRequest{}, &schemaResp)
+	var configureResp datasource.ConfigureResponse
+	d.(datasource.DataSourceWithConfigure).Configure(ctx, datasource.ConfigureRequest{ProviderData: testMeta(runtime)}, &configureResp)
+
+	typ := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+	read := func(name string) datasource.ReadResponse {
+		config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(typ, map[string]tftypes.Value{
+			"id":             tftypes.NewValue(tftypes.String, nil),
+			"name":           tftypes.NewValue(tftypes.String, name),
+			"container_name": tftypes.NewValue(tftypes.String, nil),
+		})}
+		resp := datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: tftypes.NewValue(typ, nil)}}
+		d.Read(ctx, datasource.ReadRequest{Config: config}, &resp)
+		return resp
+	}
+
+	resp := read("foo")
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", resp.Diagnostics)
+	}
+	var state registryDataSourceModel
+	resp.State.Get(ctx, &state)
+	if state.ID.ValueString() != "k3d-foo" || state.ContainerName.ValueString() != "k3d-foo" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+
+	if resp := read("bar"); !resp.Diagnostics.HasError() {
+		t.Error("expected an error for a missing registry")
+	}
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+const (
+	// etcdSnapshotDir is where k3s saves etcd snapshots by default.
+	etcdSnapshotDir = "/var/lib/rancher/k3s/server/db/snapshots"
+
+	// etcdRestorePath is where the snapshot to restore is mounted into the
+	// server resetting the cluster.
+	etcdRestorePath = "/tmp/k3d-restore-snapshot"
+
+	// etcdResetLogMessage is logged by k3s once the cluster is reset.
+	etcdResetLogMessage = "Managed etcd cluster membership has been reset"
+)
+
+// hasEmbeddedEtcd tells whether the servers run the embedded etcd, i.e. there
+// are several of them or the cluster was initialized with --cluster-init.
+func hasEmbeddedEtcd(servers []*types.Node) bool {
+	if len(servers) > 1 {
+		return true
+	}
+
+	for _, server := range servers {
+		for _, arg := range append(server.Cmd, server.Args...) {
+			if arg == "--cluster-init" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// saveEtcdSnapshot takes an etcd snapshot named name on the server node and
+// returns its path in the node. k3s appends the node name and a timestamp to
+// the name, so look for the latest snapshot starting with it.
+func saveEtcdSnapshot(ctx context.Context, runtime runtimes.Runtime, server *types.Node, name string) (string, error) {
+	if err := runtime.ExecInNode(ctx, server, []string{"k3s", "etcd-snapshot", "save", "--name", name}); err != nil {
+		return "", fmt.Errorf("failed to save etcd snapshot in node '%s': %w", server.Name, err)
+	}
+
+	logs, err := runtime.ExecInNodeGetLogs(ctx, server, []string{"sh", "-c", fmt.Sprintf("ls -1t %s/%s-* | head -n 1", etcdSnapshotDir, name)})
+	if err != nil {
+		return "", fmt.Errorf("failed to find etcd snapshot in node '%s': %w", server.Name, err)
+	}
+
+	snapshotPath, err := logs.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to find etcd snapshot in node '%s': %w", server.Name, err)
+	}
+	snapshotPath = strings.TrimSpace(snapshotPath)
+	if !strings.HasPrefix(snapshotPath, etcdSnapshotDir+"/") {
+		return "", fmt.Errorf("failed to find etcd snapshot '%s' in node '%s'", name, server.Name)
+	}
+
+	return snapshotPath, nil
+}
+
+// copyFileFromNode copies the file at src in the node to dst on the host,
+// returning its size.
+func copyFileFromNode(ctx context.Context, runtime runtimes.Runtime, node *types.Node, src string, dst string) (int64, error) {
+	reader, err := runtime.ReadFromNode(ctx, src, node)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	// the content comes as a tar archive
+	archive := tar.NewReader(reader)
+	if _, err := archive.Next(); err != nil {
+		return 0, fmt.Errorf("failed to read '%s' from node '%s': %w", src, node.Name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, archive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy '%s' from node '%s': %w", src, node.Name, err)
+	}
+
+	return size, file.Close()
+}
+
+// runClusterFromEtcdSnapshot runs the cluster like client.ClusterRun does,
+// restored from the etcd snapshot at snapshotPath on the host. The
+// initializing server is created with --cluster-reset and
+// --cluster-reset-restore-path, and started alone first: k3s restores the
+// snapshot and exits. Its container is then replaced by one without these
+// flags, taking over the restored data, and the cluster is started, the other
+// servers joining the restored one. The LocalRegistryHosting ConfigMap k3d
+// creates for the registries in use comes from the snapshot.
+func runClusterFromEtcdSnapshot(ctx context.Context, runtime runtimes.Runtime, clusterConfig *v1alpha5.ClusterConfig, snapshotPath string) error {
+	snapshotPath, err := filepath.Abs(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(snapshotPath); err != nil {
+		return fmt.Errorf("failed to read etcd snapshot: %w", err)
+	}
+
+	servers := util.FilterNodesByRole(clusterConfig.Cluster.Nodes, types.ServerRole)
+	if !hasEmbeddedEtcd(servers) {
+		return fmt.Errorf("cluster '%s' doesn't run the embedded etcd", clusterConfig.Cluster.Name)
+	}
+	initServer := servers[0]
+	for _, server := range servers {
+		if server.ServerOpts.IsInit {
+			initServer = server
+			break
+		}
+	}
+
+	resetArgs := []string{"--cluster-reset", fmt.Sprintf("--cluster-reset-restore-path=%s", etcdRestorePath)}
+	snapshotVolume := fmt.Sprintf("%s:%s:ro", snapshotPath, etcdRestorePath)
+	restart := initServer.Restart
+	initServer.Args = append(initServer.Args, resetArgs...)
+	initServer.Volumes = append(initServer.Volumes, snapshotVolume)
+	// k3s exits once reset, and would reset again if restarted
+	initServer.Restart = false
+
+	if err := client.ClusterPrep(ctx, runtime, clusterConfig); err != nil {
+		return fmt.Errorf("failed cluster preparation: %w", err)
+	}
+	if err := client.ClusterCreate(ctx, runtime, &clusterConfig.Cluster, &clusterConfig.ClusterCreateOpts); err != nil {
+		return fmt.Errorf("failed cluster creation: %w", err)
+	}
+
+	tflog.Info(ctx, "Restoring etcd snapshot", map[string]interface{}{"snapshot": snapshotPath, "node": initServer.Name})
+	if err := resetServer(ctx, runtime, initServer); err != nil {
+		return err
+	}
+
+	initServer.Args = slices.DeleteFunc(initServer.Args, func(arg string) bool { return slices.Contains(resetArgs, arg) })
+	// the fake meminfo is mounted again by k3d according to the memory limit
+	initServer.Volumes = slices.DeleteFunc(initServer.Volumes, func(volume string) bool {
+		return volume == snapshotVolume || isFakeMemoryVolume(volume)
+	})
+	initServer.Restart = restart
+	if err := recreateStoppedNode(ctx, runtime, initServer); err != nil {
+		return err
+	}
+
+	envInfo, err := client.GatherEnvironmentInfo(ctx, runtime, &clusterConfig.Cluster)
+	if err != nil {
+		return fmt.Errorf("failed to gather environment information used for cluster creation: %w", err)
+	}
+
+	if err := client.ClusterStart(ctx, runtime, &clusterConfig.Cluster, types.ClusterStartOpts{
+		WaitForServer:   clusterConfig.ClusterCreateOpts.WaitForServer,
+		Timeout:         clusterConfig.ClusterCreateOpts.Timeout,
+		NodeHooks:       clusterConfig.ClusterCreateOpts.NodeHooks,
+		EnvironmentInfo: envInfo,
+		Intent:          types.IntentClusterCreate,
+		HostAliases:     clusterConfig.ClusterCreateOpts.HostAliases,
+	}); err != nil {
+		return fmt.Errorf("failed cluster start: %w", err)
+	}
+
+	return nil
+}
+
+// resetServer starts the server, created with --cluster-reset, and waits
+// for k3s to reset the etcd cluster and exit.
+func resetServer(ctx context.Context, runtime runtimes.Runtime, server *types.Node) error {
+	if err := runtime.StartNode(ctx, server); err != nil {
+		return fmt.Errorf("failed to start node '%s': %w", server.Name, err)
+	}
+
+	if err := wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		running, _, err := runtime.GetNodeStatus(ctx, server)
+		return !running, err
+	}); err != nil {
+		return fmt.Errorf("failed to wait for node '%s' to reset etcd: %w", server.Name, err)
+	}
+
+	logs, err := nodeLogs(ctx, runtime, server)
+	if err != nil {
+		return fmt.Errorf("failed to read logs of node '%s': %w", server.Name, err)
+	}
+	if !strings.Contains(logs, etcdResetLogMessage) {
+		return fmt.Errorf("node '%s' failed to restore the etcd snapshot: %s", server.Name, tailLines(logs, defaultNodeLogsLines))
+	}
+
+	return nil
+}
+
+// recreateStoppedNode replaces the container of the stopped node by a new one
+// created from node, taking over the state of the stopped one, but doesn't
+// start it.
+func recreateStoppedNode(ctx context.Context, runtime runtimes.Runtime, node *types.Node) error {
+	old := &types.Node{Name: node.Name, Role: node.Role}
+	tmpName := fmt.Sprintf("%s-%s", node.Name, util.GenerateRandomString(5))
+	if err := runtime.RenameNode(ctx, old, tmpName); err != nil {
+		return fmt.Errorf("failed to rename node '%s': %w", node.Name, err)
+	}
+	old.Name = tmpName
+
+	node.State = types.NodeState{}
+	if err := client.NodeCreate(ctx, runtime, node, types.NodeCreateOpts{}); err != nil {
+		return fmt.Errorf("failed to create node '%s': %w", node.Name, err)
+	}
+
+	if err := copyNodeState(ctx, runtime, old, node); err != nil {
+		return fmt.Errorf("failed to copy the state of node '%s': %w", node.Name, err)
+	}
+
+	if err := client.NodeDelete(ctx, runtime, old, types.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+		return fmt.Errorf("failed to delete old node '%s': %w", tmpName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestResetServer(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	server := &types.Node{
+		Name:          "k3d-foo-server-0",
+		Role:          types.ServerRole,
+		Image:         "rancher/k3s:v1.30.4-k3s1",
+		Args:          []string{"--cluster-init", "--cluster-reset", "--cluster-reset-restore-path=" + etcdRestorePath},
+		Volumes:       []string{"/snapshots/foo:" + etcdRestorePath + ":ro"},
+		RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: string(types.ServerRole)},
+		ServerOpts:    types.ServerOpts{IsInit: true, KubeAPI: &types.ExposureOpts{Host: "0.0.0.0"}},
+	}
+	if err := runtime.CreateNode(ctx, server); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resetServer(ctx, runtime, server); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restored data
+	if err := runtime.WriteToNode(ctx, []byte("restored"), "/var/lib/rancher/k3s/server/db/etcd/member", 0600, server); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Args = []string{"--cluster-init"}
+	server.Volumes = nil
+	if err := recreateStoppedNode(ctx, runtime, server); err != nil {
+		t.Fatal(err)
+	}
+
+	recreated := runtime.node("k3d-foo-server-0")
+	if recreated == nil || recreated.State.Running {
+		t.Fatalf("expected the server to be recreated and left stopped, got %+v", recreated)
+	}
+	if expected := []string{"--cluster-init"}; !reflect.DeepEqual(recreated.Args[:1], expected) {
+		t.Errorf("expected the reset flags to be dropped, got %v", recreated.Args)
+	}
+	for _, arg := range recreated.Args {
+		if arg == "--cluster-reset" {
+			t.Errorf("expected the reset flags to be dropped, got %v", recreated.Args)
+		}
+	}
+	if got := string(runtime.files["k3d-foo-server-0"]["/var/lib/rancher/k3s/server/db/etcd/member"]); got != "restored" {
+		t.Errorf("expected the restored data to be carried over, got %q", got)
+	}
+	if len(runtime.nodes) != 1 {
+		t.Errorf("expected the reset container to be deleted, got %d nodes", len(runtime.nodes))
+	}
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+var _ function.Function = &containerNameFunction{}
+
+func newContainerNameFunction() function.Function {
+	return &containerNameFunction{}
+}
+
+type containerNameFunction struct{}
+
+func (f *containerNameFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "container_name"
+}
+
+func (f *containerNameFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Name a cluster node container",
+		MarkdownDescription: "Returns the name of the container k3d runs for a node of a cluster, e.g. `k3d-mycluster-server-0`.",
+
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "cluster",
+				MarkdownDescription: "Cluster name.",
+			},
+			function.StringParameter{
+				Name:                "role",
+				MarkdownDescription: "Role of the node: `server`, `agent` or `loadbalancer`.",
+			},
+			function.Int64Parameter{
+				Name:                "index",
+				MarkdownDescription: "Index of the node among the nodes of its role. Ignored for `loadbalancer`, clusters have a single one.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *containerNameFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var cluster, role string
+	var index int64
+	resp.Error = req.Arguments.Get(ctx, &cluster, &role, &index)
+	if resp.Error != nil {
+		return
+	}
+
+	if err := client.CheckName(cluster); err != nil {
+		resp.Error = function.NewArgumentFuncError(0, err.Error())
+		return
+	}
+
+	var name string
+	switch types.Role(role) {
+	case types.ServerRole, types.AgentRole:
+		if index < 0 {
+			resp.Error = function.NewArgumentFuncError(2, fmt.Sprintf("Invalid index %d: must not be negative", index))
+			return
+		}
+		name = client.GenerateNodeName(cluster, types.Role(role), int(index))
+	case types.LoadBalancerRole:
+		name = fmt.Sprintf("%s-%s-serverlb", types.DefaultObjectNamePrefix, cluster)
+	default:
+		resp.Error = function.NewArgumentFuncError(1, fmt.Sprintf("Invalid role %q: must be one of server, agent or loadbalancer", role))
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, name)
+}
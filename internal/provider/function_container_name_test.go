@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"testing"
+
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestContainerNameFunction(t *testing.T) {
+	cases := []struct {
+		cluster  string
+		role     string
+		index    int64
+		expected string
+		errorArg int64
+	}{
+		{cluster: "foo", role: "server", index: 0, expected: "k3d-foo-server-0"},
+		{cluster: "foo", role: "agent", index: 2, expected: "k3d-foo-agent-2"},
+		{cluster: "foo", role: "loadbalancer", expected: "k3d-foo-serverlb"},
+		{cluster: "foo_bar", role: "server", errorArg: 0},
+		{cluster: "foo", role: "registry", errorArg: 1},
+		{cluster: "foo", role: "server", index: -1, errorArg: 2},
+	}
+
+	for _, c := range cases {
+		result, funcErr := testRunFunction(t, newContainerNameFunction, fwtypes.StringValue(c.cluster), fwtypes.StringValue(c.role), fwtypes.Int64Value(c.index))
+		if c.expected == "" {
+			if funcErr == nil {
+				t.Errorf("%s, %s, %d: expected an error, got %s", c.cluster, c.role, c.index, result)
+			} else if funcErr.FunctionArgument == nil || *funcErr.FunctionArgument != c.errorArg {
+				t.Errorf("%s, %s, %d: expected an error for argument %d, got %s", c.cluster, c.role, c.index, c.errorArg, funcErr)
+			}
+			continue
+		}
+
+		if funcErr != nil {
+			t.Errorf("%s, %s, %d: unexpected error: %s", c.cluster, c.role, c.index, funcErr)
+			continue
+		}
+		if name := result.(fwtypes.String).ValueString(); name != c.expected {
+			t.Errorf("%s, %s, %d: expected %s, got %s", c.cluster, c.role, c.index, c.expected, name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+var _ function.Function = &nodeFilterFunction{}
+
+func newNodeFilterFunction() function.Function {
+	return &nodeFilterFunction{}
+}
+
+type nodeFilterFunction struct{}
+
+func (f *nodeFilterFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "node_filter"
+}
+
+func (f *nodeFilterFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Build a node filter",
+		MarkdownDescription: "Returns the node filter selecting the nodes of a role, e.g. `server:0` or `agent:*`, to be used in `node_filters`.",
+
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "role",
+				MarkdownDescription: "Role of the nodes: `server`, `agent`, `loadbalancer` or `all`.",
+			},
+			function.StringParameter{
+				Name:                "index",
+				MarkdownDescription: "Index of the nodes: a number, a list (`0,1`), a range (`0-2`) or `*` for all of them. Empty for `loadbalancer` and `all`.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *nodeFilterFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var role, index string
+	resp.Error = req.Arguments.Get(ctx, &role, &index)
+	if resp.Error != nil {
+		return
+	}
+
+	filter, err := buildNodeFilter(role, index)
+	if err != nil {
+		resp.Error = err
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, filter)
+}
+
+// buildNodeFilter builds the node filter role:index, checked against the k3d
+// grammar. The error points at the faulty argument.
+func buildNodeFilter(role, index string) (string, *function.FuncError) {
+	if !util.NodeFilterRegexp.MatchString(role) {
+		return "", function.NewArgumentFuncError(0, fmt.Sprintf("Invalid role %q: must be one of server, agent, loadbalancer or all", role))
+	}
+
+	filter := role
+	if index != "" {
+		filter = fmt.Sprintf("%s:%s", role, index)
+	}
+
+	// the index must be the subset of the filter, not its suffix
+	f, err := parseNodeFilter(filter)
+	if err != nil {
+		return "", function.NewArgumentFuncError(1, err.Error())
+	}
+	if f.subset != index {
+		return "", function.NewArgumentFuncError(1, fmt.Sprintf("Invalid index %q: must be a number, a list (0,1), a range (0-2) or *", index))
+	}
+
+	return filter, nil
+}
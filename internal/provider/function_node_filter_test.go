@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"testing"
+
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestNodeFilterFunction(t *testing.T) {
+	cases := []struct {
+		role     string
+		index    string
+		expected string
+		errorArg int64
+	}{
+		{role: "server", index: "0", expected: "server:0"},
+		{role: "agent", index: "*", expected: "agent:*"},
+		{role: "agents", index: "0,2", expected: "agents:0,2"},
+		{role: "server", index: "1-", expected: "server:1-"},
+		{role: "loadbalancer", expected: "loadbalancer"},
+		{role: "all", expected: "all"},
+		{role: "agent[0]", errorArg: 0},
+		{role: "worker", index: "0", errorArg: 0},
+		{role: "server", index: "[0]", errorArg: 1},
+		{role: "server", index: "-1", expected: "server:-1"},
+		{role: "server", index: "a", errorArg: 1},
+		{role: "agent", errorArg: 1},
+	}
+
+	for _, c := range cases {
+		result, funcErr := testRunFunction(t, newNodeFilterFunction, fwtypes.StringValue(c.role), fwtypes.StringValue(c.index))
+		if c.expected == "" {
+			if funcErr == nil {
+				t.Errorf("%s, %s: expected an error, got %s", c.role, c.index, result)
+			} else if funcErr.FunctionArgument == nil || *funcErr.FunctionArgument != c.errorArg {
+				t.Errorf("%s, %s: expected an error for argument %d, got %s", c.role, c.index, c.errorArg, funcErr)
+			}
+			continue
+		}
+
+		if funcErr != nil {
+			t.Errorf("%s, %s: unexpected error: %s", c.role, c.index, funcErr)
+			continue
+		}
+		if filter := result.(fwtypes.String).ValueString(); filter != c.expected {
+			t.Errorf("%s, %s: expected %s, got %s", c.role, c.index, c.expected, filter)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+
+	cliutil "github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+var _ function.Function = &parsePortMappingFunction{}
+
+func newParsePortMappingFunction() function.Function {
+	return &parsePortMappingFunction{}
+}
+
+type parsePortMappingFunction struct{}
+
+type portMappingModel struct {
+	Host          string   `tfsdk:"host"`
+	HostPort      int64    `tfsdk:"host_port"`
+	ContainerPort int64    `tfsdk:"container_port"`
+	Protocol      string   `tfsdk:"protocol"`
+	NodeFilters   []string `tfsdk:"node_filters"`
+}
+
+var portMappingAttrTypes = map[string]attr.Type{
+	"host":           fwtypes.StringType,
+	"host_port":      fwtypes.Int64Type,
+	"container_port": fwtypes.Int64Type,
+	"protocol":       fwtypes.StringType,
+	"node_filters":   fwtypes.ListType{ElemType: fwtypes.StringType},
+}
+
+func (f *parsePortMappingFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "parse_port_mapping"
+}
+
+func (f *parsePortMappingFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Parse a port mapping",
+		MarkdownDescription: "Parses a port mapping as given to `k3d cluster create --port`, e.g. `8080:80@loadbalancer`, into the attributes of the cluster `port` block. Port ranges give one element per port.",
+
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "mapping",
+				MarkdownDescription: "Port mapping: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER[;NODEFILTER...]]`.",
+			},
+		},
+		VariadicParameter: function.MapParameter{
+			Name:                "counts",
+			MarkdownDescription: "Optional `servers` and `agents` counts of the cluster, e.g. `{ servers = 1, agents = 2 }`, to check the indices of the node filters against as the cluster resource does.",
+			ElementType:         fwtypes.Int64Type,
+		},
+		Return: function.ListReturn{
+			ElementType: fwtypes.ObjectType{AttrTypes: portMappingAttrTypes},
+		},
+	}
+}
+
+func (f *parsePortMappingFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var mapping string
+	var counts []map[string]int64
+	resp.Error = req.Arguments.Get(ctx, &mapping, &counts)
+	if resp.Error != nil {
+		return
+	}
+
+	nodeCounts, funcErr := expandNodeCounts(counts)
+	if funcErr != nil {
+		resp.Error = funcErr
+		return
+	}
+
+	ports, err := parsePortMapping(mapping, nodeCounts)
+	if err != nil {
+		resp.Error = function.NewArgumentFuncError(0, err.Error())
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, ports)
+}
+
+// expandNodeCounts returns the counts of the servers and agents given to a
+// function, nil if not given.
+func expandNodeCounts(counts []map[string]int64) (map[types.Role]int, *function.FuncError) {
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	if len(counts) > 1 {
+		return nil, function.NewArgumentFuncError(2, "Only one counts argument is allowed")
+	}
+
+	nodeCounts := map[types.Role]int{}
+	for key, count := range counts[0] {
+		switch key {
+		case "servers":
+			nodeCounts[types.ServerRole] = int(count)
+		case "agents":
+			nodeCounts[types.AgentRole] = int(count)
+		default:
+			return nil, function.NewArgumentFuncError(1, fmt.Sprintf("Invalid count %q: must be servers or agents", key))
+		}
+	}
+
+	return nodeCounts, nil
+}
+
+// parsePortMapping parses mapping, checking its node filters like the cluster
+// resource does, their indices only against counts if not nil.
+func parsePortMapping(mapping string, counts map[types.Role]int) ([]portMappingModel, error) {
+	spec, nodeFilters, err := cliutil.SplitFiltersFromFlag(mapping)
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range nodeFilters {
+		f, err := parseNodeFilter(filter)
+		if err == nil {
+			err = f.checkSuffix(filter, portNodeFilterSuffixes)
+		}
+		if err == nil && counts != nil {
+			if err = f.checkNodes(counts, false); err != nil {
+				err = fmt.Errorf("node filter %q: %w", filter, err)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid port mapping %q: %w", mapping, err)
+		}
+	}
+	if nodeFilters == nil {
+		nodeFilters = []string{}
+	}
+
+	portMappings, err := nat.ParsePortSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid port mapping %q: %w", mapping, err)
+	}
+
+	ports := make([]portMappingModel, 0, len(portMappings))
+	for _, pm := range portMappings {
+		var hostPort int64
+		if pm.Binding.HostPort != "" {
+			hostPort, err = strconv.ParseInt(pm.Binding.HostPort, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid host port in port mapping %q: %w", mapping, err)
+			}
+		}
+
+		ports = append(ports, portMappingModel{
+			Host:          pm.Binding.HostIP,
+			HostPort:      hostPort,
+			ContainerPort: int64(pm.Port.Int()),
+			Protocol:      strings.ToUpper(pm.Port.Proto()),
+			NodeFilters:   nodeFilters,
+		})
+	}
+
+	return ports, nil
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestParsePortMappingFunction(t *testing.T) {
+	cases := []struct {
+		mapping  string
+		counts   map[string]int64
+		expected []portMappingModel
+	}{
+		{
+			mapping:  "80",
+			expected: []portMappingModel{{ContainerPort: 80, Protocol: "TCP", NodeFilters: []string{}}},
+		},
+		{
+			mapping:  "8080:80@loadbalancer",
+			expected: []portMappingModel{{HostPort: 8080, ContainerPort: 80, Protocol: "TCP", NodeFilters: []string{"loadbalancer"}}},
+		},
+		{
+			mapping:  "127.0.0.1:5353:53/udp@agent:0;agent:1",
+			expected: []portMappingModel{{Host: "127.0.0.1", HostPort: 5353, ContainerPort: 53, Protocol: "UDP", NodeFilters: []string{"agent:0", "agent:1"}}},
+		},
+		{
+			mapping: "8080-8081:80-81",
+			expected: []portMappingModel{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "TCP", NodeFilters: []string{}},
+				{HostPort: 8081, ContainerPort: 81, Protocol: "TCP", NodeFilters: []string{}},
+			},
+		},
+		{
+			mapping:  "8080:80@agent:1;loadbalancer:direct",
+			counts:   map[string]int64{"servers": 1, "agents": 2},
+			expected: []portMappingModel{{HostPort: 8080, ContainerPort: 80, Protocol: "TCP", NodeFilters: []string{"agent:1", "loadbalancer:direct"}}},
+		},
+		{mapping: "foo:80"},
+		{mapping: "8080:80@agents[0]"},
+		{mapping: "8080:80@"},
+		{mapping: "8080:80@agent"},
+		{mapping: "8080:80@loadbalancer:nope"},
+		{mapping: "8080:80@agent:2", counts: map[string]int64{"servers": 1, "agents": 2}},
+	}
+
+	for _, c := range cases {
+		result, funcErr := testRunFunction(t, newParsePortMappingFunction, fwtypes.StringValue(c.mapping), testNodeCounts(c.counts))
+		if c.expected == nil {
+			if funcErr == nil {
+				t.Errorf("%s: expected an error, got %s", c.mapping, result)
+			} else if funcErr.FunctionArgument == nil || *funcErr.FunctionArgument != 0 {
+				t.Errorf("%s: expected an error for the mapping, got %s", c.mapping, funcErr)
+			}
+			continue
+		}
+
+		if funcErr != nil {
+			t.Errorf("%s: unexpected error: %s", c.mapping, funcErr)
+			continue
+		}
+
+		var ports []portMappingModel
+		if diags := result.(fwtypes.List).ElementsAs(context.Background(), &ports, false); diags.HasError() {
+			t.Fatalf("%s: unexpected error: %v", c.mapping, diags)
+		}
+		if !reflect.DeepEqual(ports, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.mapping, c.expected, ports)
+		}
+	}
+}
+
+func TestParsePortMappingFunction_invalidCounts(t *testing.T) {
+	_, funcErr := testRunFunction(t, newParsePortMappingFunction, fwtypes.StringValue("80"), testNodeCounts(map[string]int64{"workers": 1}))
+	if funcErr == nil || funcErr.FunctionArgument == nil || *funcErr.FunctionArgument != 1 {
+		t.Errorf("expected an error for the counts, got %v", funcErr)
+	}
+}
+
+// testNodeCounts returns the variadic counts argument of the functions, none
+// if counts is nil.
+func testNodeCounts(counts map[string]int64) attr.Value {
+	if counts == nil {
+		return fwtypes.TupleValueMust([]attr.Type{}, []attr.Value{})
+	}
+
+	elements := map[string]attr.Value{}
+	for k, v := range counts {
+		elements[k] = fwtypes.Int64Value(v)
+	}
+	mapType := fwtypes.MapType{ElemType: fwtypes.Int64Type}
+
+	return fwtypes.TupleValueMust([]attr.Type{mapType}, []attr.Value{fwtypes.MapValueMust(fwtypes.Int64Type, elements)})
+}
@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// hostPort is a port of the host bound by a container.
+type hostPort struct {
+	ip    string
+	port  string
+	proto string
+}
+
+func (p hostPort) String() string {
+	ip := p.ip
+	if ip == "" {
+		ip = "0.0.0.0"
+	}
+
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(ip, p.port), p.proto)
+}
+
+// overlaps tells whether p and o can't be bound at the same time.
+func (p hostPort) overlaps(o hostPort) bool {
+	return p.port == o.port && p.proto == o.proto && (isAnyAddress(p.ip) || isAnyAddress(o.ip) || p.ip == o.ip)
+}
+
+func isAnyAddress(ip string) bool {
+	return ip == "" || net.ParseIP(ip).IsUnspecified()
+}
+
+// clusterHostPorts returns the host ports the nodes of cluster ask for,
+// leaving out the ones picked by the runtime.
+func clusterHostPorts(cluster *types.Cluster) []hostPort {
+	seen := map[hostPort]bool{}
+	var ports []hostPort
+	add := func(port nat.Port, binding nat.PortBinding) {
+		if binding.HostPort == "" || binding.HostPort == "0" {
+			return
+		}
+
+		p := hostPort{ip: binding.HostIP, port: binding.HostPort, proto: port.Proto()}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+
+	// the kube API is bound to the load balancer, or the first server
+	add(nat.Port(types.DefaultAPIPort+"/tcp"), cluster.KubeAPI.Binding)
+	for _, node := range cluster.Nodes {
+		for port, bindings := range node.Ports {
+			for _, binding := range bindings {
+				add(port, binding)
+			}
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].String() < ports[j].String()
+	})
+
+	return ports
+}
+
+// checkNewHostPorts returns a CustomizeDiffFunc checking, while planning,
+// that the host ports the port blocks of the resource, and kube_api if
+// withKubeAPI, ask for aren't bound already. The ones held by the containers
+// of the resource itself, told by owns, are left out: they're released when
+// it is replaced, and were checked when it was created.
+func checkNewHostPorts(withKubeAPI bool, owns func(d *schema.ResourceDiff, node *types.Node) bool) schema.CustomizeDiffFunc {
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		wanted := configuredHostPorts(d, "port", func(v map[string]interface{}) hostPort {
+			return hostPort{ip: v["host"].(string), port: portString(v["host_port"].(int)), proto: strings.ToLower(v["protocol"].(string))}
+		})
+		if withKubeAPI {
+			wanted = append(wanted, configuredHostPorts(d, "kube_api", func(v map[string]interface{}) hostPort {
+				return hostPort{ip: v["host_ip"].(string), port: portString(v["host_port"].(int))}
+			})...)
+		}
+		if len(wanted) == 0 {
+			return nil
+		}
+
+		runtime := meta.(*apiClient).runtime
+		nodes, err := runtime.GetNodesByLabel(ctx, types.DefaultRuntimeLabels)
+		if err != nil {
+			return fmt.Errorf("failed to list k3d containers: %w", err)
+		}
+		var own []*types.Node
+		for _, node := range nodes {
+			if owns(d, node) {
+				own = append(own, node)
+			}
+		}
+
+		var ports []hostPort
+		for _, p := range wanted {
+			if findHostPortHolder(own, p) == nil && !slices.Contains(ports, p) {
+				ports = append(ports, p)
+			}
+		}
+
+		return checkHostPorts(ctx, runtime, ports)
+	}
+}
+
+// configuredHostPorts returns the host ports bound by the blocks under key,
+// as told by hostPortOf, leaving out the ones picked by the runtime.
+func configuredHostPorts(d *schema.ResourceDiff, key string, hostPortOf func(map[string]interface{}) hostPort) []hostPort {
+	var ports []hostPort
+	for _, block := range d.Get(key).([]interface{}) {
+		v, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if p := hostPortOf(v); p.port != "" {
+			if p.proto == "" {
+				p.proto = "tcp"
+			}
+			ports = append(ports, p)
+		}
+	}
+
+	return ports
+}
+
+// portString returns port as a host port, empty if the runtime picks it.
+func portString(port int) string {
+	if port == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(port)
+}
+
+// checkHostPorts checks that none of ports is bound already, by a k3d
+// container or, if the runtime runs locally, by another process. The error
+// lists every conflict, along with the container holding the port.
+func checkHostPorts(ctx context.Context, runtime runtimes.Runtime, ports []hostPort) error {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	nodes, err := runtime.GetNodesByLabel(ctx, types.DefaultRuntimeLabels)
+	if err != nil {
+		return fmt.Errorf("failed to list k3d containers: %w", err)
+	}
+	local := isLocalRuntime(runtime)
+
+	var errs []error
+	for _, p := range ports {
+		if holder := findHostPortHolder(nodes, p); holder != nil {
+			errs = append(errs, fmt.Errorf("host port %s is already bound by k3d container %s", p, holder.Name))
+			continue
+		}
+
+		if local && !isHostPortFree(p) {
+			errs = append(errs, fmt.Errorf("host port %s is already in use on the host", p))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func findHostPortHolder(nodes []*types.Node, p hostPort) *types.Node {
+	for _, node := range nodes {
+		for port, bindings := range node.Ports {
+			for _, binding := range bindings {
+				if p.overlaps(hostPort{ip: binding.HostIP, port: binding.HostPort, proto: port.Proto()}) {
+					return node
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isLocalRuntime tells whether the containers publish their ports on this
+// machine, rather than on a remote docker host.
+func isLocalRuntime(runtime runtimes.Runtime) bool {
+	switch host := runtime.GetHost(); host {
+	case "", "localhost", "host.docker.internal":
+		return true
+	default:
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+}
+
+// isHostPortFree tells whether p can be bound on this machine. Only an address
+// in use counts, e.g. privileged ports can't be bound by the provider but
+// they can by the runtime.
+func isHostPortFree(p hostPort) bool {
+	address := net.JoinHostPort(p.ip, p.port)
+
+	var err error
+	if p.proto == "udp" {
+		var conn net.PacketConn
+		if conn, err = net.ListenPacket("udp", address); err == nil {
+			conn.Close()
+		}
+	} else {
+		var listener net.Listener
+		if listener, err = net.Listen("tcp", address); err == nil {
+			listener.Close()
+		}
+	}
+
+	return !errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+func TestClusterHostPorts(t *testing.T) {
+	cluster := &types.Cluster{
+		KubeAPI: &types.ExposureOpts{
+			PortMapping: nat.PortMapping{Binding: nat.PortBinding{HostIP: "0.0.0.0", HostPort: "6550"}},
+		},
+		Nodes: []*types.Node{
+			{
+				Name: "k3d-foo-serverlb",
+				Ports: nat.PortMap{
+					"6443/tcp": {{HostIP: "0.0.0.0", HostPort: "6550"}},
+					"80/tcp":   {{HostIP: "127.0.0.1", HostPort: "8080"}},
+					"53/udp":   {{HostPort: "5353"}},
+				},
+			},
+			{
+				Name: "k3d-foo-agent-0",
+				Ports: nat.PortMap{
+					"443/tcp": {{HostIP: "0.0.0.0", HostPort: ""}},
+				},
+			},
+		},
+	}
+
+	expected := []hostPort{
+		{ip: "", port: "5353", proto: "udp"},
+		{ip: "0.0.0.0", port: "6550", proto: "tcp"},
+		{ip: "127.0.0.1", port: "8080", proto: "tcp"},
+	}
+	if ports := clusterHostPorts(cluster); !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected %v, got %v", expected, ports)
+	}
+}
+
+func TestHostPortOverlaps(t *testing.T) {
+	cases := []struct {
+		a, b     hostPort
+		expected bool
+	}{
+		{a: hostPort{ip: "0.0.0.0", port: "80", proto: "tcp"}, b: hostPort{ip: "127.0.0.1", port: "80", proto: "tcp"}, expected: true},
+		{a: hostPort{ip: "", port: "80", proto: "tcp"}, b: hostPort{ip: "::", port: "80", proto: "tcp"}, expected: true},
+		{a: hostPort{ip: "127.0.0.1", port: "80", proto: "tcp"}, b: hostPort{ip: "127.0.0.1", port: "80", proto: "tcp"}, expected: true},
+		{a: hostPort{ip: "127.0.0.1", port: "80", proto: "tcp"}, b: hostPort{ip: "127.0.0.2", port: "80", proto: "tcp"}},
+		{a: hostPort{ip: "0.0.0.0", port: "80", proto: "tcp"}, b: hostPort{ip: "0.0.0.0", port: "80", proto: "udp"}},
+		{a: hostPort{ip: "0.0.0.0", port: "80", proto: "tcp"}, b: hostPort{ip: "0.0.0.0", port: "8080", proto: "tcp"}},
+	}
+
+	for _, c := range cases {
+		if actual := c.a.overlaps(c.b); actual != c.expected {
+			t.Errorf("%s and %s: expected %t, got %t", c.a, c.b, c.expected, actual)
+		}
+	}
+}
+
+func TestCheckHostPorts(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	if err := runtime.CreateNode(ctx, &types.Node{
+		Name:          "k3d-bar-serverlb",
+		RuntimeLabels: map[string]string{"app": "k3d"},
+		Ports: nat.PortMap{
+			"6443/tcp": {{HostIP: "0.0.0.0", HostPort: "6550"}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, listenerPort, _ := net.SplitHostPort(listener.Addr().String())
+
+	if err := checkHostPorts(ctx, runtime, []hostPort{{ip: "127.0.0.1", port: "6551", proto: "udp"}}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err = checkHostPorts(ctx, runtime, []hostPort{
+		{ip: "127.0.0.1", port: "6550", proto: "tcp"},
+		{ip: "127.0.0.1", port: listenerPort, proto: "tcp"},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, expected := range []string{
+		"host port 127.0.0.1:6550/tcp is already bound by k3d container k3d-bar-serverlb",
+		"host port 127.0.0.1:" + listenerPort + "/tcp is already in use on the host",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the error, got %s", expected, err)
+		}
+	}
+}
+
+func TestCheckNewHostPorts(t *testing.T) {
+	testFakeClusterEnv(t)
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	meta := testMeta(runtime)
+	r := resourceCluster()
+
+	held, err := util.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	free, err := util.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.CreateNode(ctx, &types.Node{
+		Name:          "k3d-bar-serverlb",
+		RuntimeLabels: map[string]string{"app": "k3d"},
+		Ports: nat.PortMap{
+			"80/tcp": {{HostIP: "0.0.0.0", HostPort: strconv.Itoa(held)}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	port := func(host string, hostPort int) map[string]interface{} {
+		p := testPort(host, hostPort, 80, "TCP")
+		p["node_filters"] = []interface{}{"server:0:direct"}
+		return p
+	}
+	config := testFakeClusterConfig("foo")
+
+	config["port"] = []interface{}{port("", held)}
+	_, err = r.Diff(ctx, nil, terraform.NewResourceConfigRaw(config), meta)
+	if err == nil || !strings.Contains(err.Error(), "is already bound by k3d container k3d-bar-serverlb") {
+		t.Errorf("expected the held port to be reported, got %v", err)
+	}
+
+	config["port"] = []interface{}{port("", free)}
+	state := testApply(t, r, nil, config, meta)
+
+	// the port is held by the cluster itself until it's replaced
+	config["port"] = []interface{}{port("127.0.0.1", free)}
+	if _, err := r.Diff(ctx, state, terraform.NewResourceConfigRaw(config), meta); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	config["port"] = []interface{}{port("", free), port("", held)}
+	_, err = r.Diff(ctx, state, terraform.NewResourceConfigRaw(config), meta)
+	if err == nil || !strings.Contains(err.Error(), "is already bound by k3d container k3d-bar-serverlb") {
+		t.Errorf("expected the held port to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// customizeKubeconfig renames the current context of a kubeconfig fetched from
+// k3d and points its server to another host, keeping the port. IPv6 hosts are
+// bracketed, which k3d doesn't do.
+func customizeKubeconfig(config *clientcmdapi.Config, contextName string, serverHost string) error {
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok || context == nil {
+		return fmt.Errorf("kubeconfig has no current context '%s'", config.CurrentContext)
+	}
+
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok || cluster == nil {
+		return fmt.Errorf("kubeconfig has no cluster '%s'", context.Cluster)
+	}
+
+	hostPort := strings.TrimPrefix(cluster.Server, "https://")
+	i := strings.LastIndex(hostPort, ":")
+	if i < 0 {
+		return fmt.Errorf("kubeconfig server '%s' has no port", cluster.Server)
+	}
+
+	host := strings.Trim(hostPort[:i], "[]")
+	if serverHost != "" {
+		host = serverHost
+	}
+	cluster.Server = fmt.Sprintf("https://%s", net.JoinHostPort(host, hostPort[i+1:]))
+
+	if contextName != "" && contextName != config.CurrentContext {
+		config.Contexts[contextName] = context
+		delete(config.Contexts, config.CurrentContext)
+		config.CurrentContext = contextName
+	}
+
+	return nil
+}
+
+// updateDefaultKubeconfig merges the customized kubeconfig of the cluster into
+// the default one, like client.KubeconfigGetWrite does with the k3d one.
+func updateDefaultKubeconfig(ctx context.Context, runtime runtimes.Runtime, d *schema.ResourceData, cluster *types.Cluster) error {
+	config, err := client.KubeconfigGet(ctx, runtime, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig for cluster '%s': %w", cluster.Name, err)
+	}
+
+	if err := customizeKubeconfig(config, d.Get("kubeconfig.0.context_name").(string), d.Get("kubeconfig.0.server_host").(string)); err != nil {
+		return err
+	}
+
+	path, err := client.KubeconfigGetDefaultPath()
+	if err != nil {
+		return err
+	}
+
+	existing, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create kubeconfig directory '%s': %w", filepath.Dir(path), err)
+		}
+		existing = clientcmdapi.NewConfig()
+	} else if err != nil {
+		return fmt.Errorf("failed to load kubeconfig '%s': %w", path, err)
+	}
+
+	return client.KubeconfigMerge(ctx, config, existing, path, true, d.Get("kubeconfig.0.switch_current_context").(bool))
+}
+
+// kubeconfigContextName returns the name of the context of the cluster in its
+// kubeconfig, k3d's one unless contextName is set.
+func kubeconfigContextName(clusterName string, contextName string) string {
+	if contextName != "" {
+		return contextName
+	}
+
+	return fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, clusterName)
+}
+
+// renameDefaultKubeconfigContext renames a context of the default kubeconfig,
+// keeping it current if it is.
+func renameDefaultKubeconfigContext(ctx context.Context, oldName string, newName string) error {
+	path, err := client.KubeconfigGetDefaultPath()
+	if err != nil {
+		return err
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig '%s': %w", path, err)
+	}
+
+	context, ok := config.Contexts[oldName]
+	if !ok || oldName == newName {
+		return nil
+	}
+
+	config.Contexts[newName] = context
+	delete(config.Contexts, oldName)
+	if config.CurrentContext == oldName {
+		config.CurrentContext = newName
+	}
+
+	return client.KubeconfigWrite(ctx, config, path)
+}
+
+// removeDefaultKubeconfigContext removes a context k3d doesn't know about from
+// the default kubeconfig.
+func removeDefaultKubeconfigContext(ctx context.Context, contextName string) error {
+	path, err := client.KubeconfigGetDefaultPath()
+	if err != nil {
+		return err
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := config.Contexts[contextName]; !ok {
+		return nil
+	}
+
+	delete(config.Contexts, contextName)
+	if config.CurrentContext == contextName {
+		config.CurrentContext = ""
+	}
+
+	return client.KubeconfigWrite(ctx, config, path)
+}
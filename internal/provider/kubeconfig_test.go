@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func testKubeconfig(server string) *clientcmdapi.Config {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["k3d-foo"] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: []byte("ca")}
+	config.AuthInfos["admin@k3d-foo"] = &clientcmdapi.AuthInfo{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key")}
+	config.Contexts["k3d-foo"] = &clientcmdapi.Context{Cluster: "k3d-foo", AuthInfo: "admin@k3d-foo"}
+	config.CurrentContext = "k3d-foo"
+	return config
+}
+
+func TestCustomizeKubeconfig(t *testing.T) {
+	cases := []struct {
+		name        string
+		server      string
+		contextName string
+		serverHost  string
+		expected    string
+	}{
+		{"unchanged", "https://0.0.0.0:6443", "", "", "https://0.0.0.0:6443"},
+		{"ipv6", "https://::1:6443", "", "", "https://[::1]:6443"},
+		{"server host", "https://0.0.0.0:6443", "", "host.docker.internal", "https://host.docker.internal:6443"},
+		{"context name", "https://0.0.0.0:6443", "bar", "", "https://0.0.0.0:6443"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := testKubeconfig(c.server)
+			if err := customizeKubeconfig(config, c.contextName, c.serverHost); err != nil {
+				t.Fatal(err)
+			}
+
+			if server := config.Clusters["k3d-foo"].Server; server != c.expected {
+				t.Errorf("expected server %s, got %s", c.expected, server)
+			}
+
+			contextName := "k3d-foo"
+			if c.contextName != "" {
+				contextName = c.contextName
+			}
+			if config.CurrentContext != contextName || len(config.Contexts) != 1 || config.Contexts[contextName] == nil {
+				t.Errorf("expected only context %s, got %s in %v", contextName, config.CurrentContext, config.Contexts)
+			}
+		})
+	}
+}
+
+func TestCustomizeKubeconfig_missingContext(t *testing.T) {
+	config := testKubeconfig("https://0.0.0.0:6443")
+	config.CurrentContext = "bar"
+
+	if err := customizeKubeconfig(config, "", ""); err == nil {
+		t.Error("expected an error for a missing context")
+	}
+}
+
+func TestFlattenCredentials(t *testing.T) {
+	config := testKubeconfig("https://0.0.0.0:6443")
+	if err := customizeKubeconfig(config, "bar", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials, err := flattenCredentials(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := credentials[0].(map[string]interface{})
+	if creds["host"] != "https://0.0.0.0:6443" || creds["client_certificate"] != "cert" || creds["client_key"] != "key" || creds["cluster_ca_certificate"] != "ca" {
+		t.Errorf("unexpected credentials %v", creds)
+	}
+	if raw := creds["raw"].(string); !strings.Contains(raw, "current-context: bar") {
+		t.Errorf("expected the raw kubeconfig to use the context bar, got %s", raw)
+	}
+}
+
+func TestFlattenCredentials_invalid(t *testing.T) {
+	cases := []struct {
+		name       string
+		invalidate func(config *clientcmdapi.Config)
+	}{
+		{"missing context", func(config *clientcmdapi.Config) { config.CurrentContext = "bar" }},
+		{"missing cluster", func(config *clientcmdapi.Config) { delete(config.Clusters, "k3d-foo") }},
+		{"missing user", func(config *clientcmdapi.Config) { delete(config.AuthInfos, "admin@k3d-foo") }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := testKubeconfig("https://0.0.0.0:6443")
+			c.invalidate(config)
+
+			if _, err := flattenCredentials(config); err == nil {
+				t.Errorf("expected an error for a %s", c.name)
+			}
+		})
+	}
+}
+
+func TestRenameDefaultKubeconfigContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	t.Setenv("KUBECONFIG", path)
+
+	if err := renameDefaultKubeconfigContext(context.Background(), "k3d-foo", "bar"); err != nil {
+		t.Errorf("expected a missing kubeconfig to be ignored, got %s", err)
+	}
+
+	if err := clientcmd.WriteToFile(*testKubeconfig("https://0.0.0.0:6443"), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameDefaultKubeconfigContext(context.Background(), "k3d-foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CurrentContext != "bar" || len(config.Contexts) != 1 || config.Contexts["bar"] == nil {
+		t.Errorf("expected only context bar, got %s in %v", config.CurrentContext, config.Contexts)
+	}
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/sirupsen/logrus"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+// k3dLogMask replaces the secrets in k3d log entries, like tflog does.
+const k3dLogMask = "***"
+
+// k3dLogHook forwards every entry logged by k3d through logrus to tflog, so
+// that it shows up in Terraform's own logs (TF_LOG) instead of the plugin's
+// unstructured stderr.
+//
+// k3d does not pass a context to logrus, so unless an entry carries one, the
+// hook attributes it to the operation that most recently opened a scope (see
+// k3dLogScope) and falls back to the context the provider was configured with.
+// The entries of operations Terraform runs in parallel may be attributed to
+// one another.
+type k3dLogHook struct {
+	mu      sync.Mutex
+	baseCtx context.Context
+	scopes  []*k3dLogScopeCtx
+	secrets map[string]bool
+}
+
+// k3dLogScopeCtx is the context of an operation k3d log entries are
+// attributed to.
+type k3dLogScopeCtx struct {
+	ctx context.Context
+}
+
+var (
+	k3dLogs        = &k3dLogHook{baseCtx: context.Background(), secrets: map[string]bool{}}
+	k3dLogHookOnce sync.Once
+)
+
+// installK3dLogHook routes k3d's logger into tflog. It is safe to call
+// several times, the hook is only registered once.
+func installK3dLogHook(ctx context.Context) {
+	k3dLogs.mu.Lock()
+	k3dLogs.baseCtx = ctx
+	k3dLogs.mu.Unlock()
+
+	k3dLogHookOnce.Do(func() {
+		// let everything through to the hook, tflog applies TF_LOG filtering
+		l.Log().SetLevel(logrus.TraceLevel)
+		l.Log().SetOutput(io.Discard)
+		l.Log().AddHook(k3dLogs)
+	})
+}
+
+// k3dLogScope makes ctx the context k3d log entries are attributed to until
+// the returned function is called. Scopes don't wait for each other, when
+// several are open the most recent one gets the entries.
+func k3dLogScope(ctx context.Context) (context.Context, func()) {
+	scope := &k3dLogScopeCtx{ctx: ctx}
+
+	k3dLogs.mu.Lock()
+	k3dLogs.scopes = append(k3dLogs.scopes, scope)
+	k3dLogs.mu.Unlock()
+
+	return ctx, func() {
+		k3dLogs.mu.Lock()
+		defer k3dLogs.mu.Unlock()
+
+		for i, s := range k3dLogs.scopes {
+			if s == scope {
+				k3dLogs.scopes = append(k3dLogs.scopes[:i], k3dLogs.scopes[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// maskK3dLogSecrets hides secrets from every k3d log entry from now on, as
+// k3d logs them in commands and node specs at debug and trace levels, and
+// from the entries logged with the returned context.
+func maskK3dLogSecrets(ctx context.Context, secrets ...string) context.Context {
+	var masked []string
+	k3dLogs.mu.Lock()
+	for _, secret := range secrets {
+		if secret != "" {
+			k3dLogs.secrets[secret] = true
+			masked = append(masked, secret)
+		}
+	}
+	k3dLogs.mu.Unlock()
+
+	if len(masked) == 0 {
+		return ctx
+	}
+
+	ctx = tflog.MaskMessageStrings(ctx, masked...)
+	return tflog.MaskAllFieldValuesStrings(ctx, masked...)
+}
+
+func (h *k3dLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *k3dLogHook) Fire(entry *logrus.Entry) error {
+	h.mu.Lock()
+	ctx := entry.Context
+	if ctx == nil && len(h.scopes) > 0 {
+		ctx = h.scopes[len(h.scopes)-1].ctx
+	}
+	if ctx == nil {
+		ctx = h.baseCtx
+	}
+	mask := func(s string) string {
+		for secret := range h.secrets {
+			s = strings.ReplaceAll(s, secret, k3dLogMask)
+		}
+		return s
+	}
+
+	message := mask(entry.Message)
+	fields := make(map[string]interface{}, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			v = mask(s)
+		}
+		fields[k] = v
+	}
+	fields["source"] = "k3d"
+	h.mu.Unlock()
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		tflog.Error(ctx, message, fields)
+	case logrus.WarnLevel:
+		tflog.Warn(ctx, message, fields)
+	case logrus.InfoLevel:
+		tflog.Info(ctx, message, fields)
+	case logrus.DebugLevel:
+		tflog.Debug(ctx, message, fields)
+	default:
+		tflog.Trace(ctx, message, fields)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+func TestK3dLogHook(t *testing.T) {
+	var output bytes.Buffer
+
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	installK3dLogHook(ctx)
+
+	scoped := tflog.SetField(ctx, "cluster", "bar")
+	_, done := k3dLogScope(scoped)
+	l.Log().WithField("node", "k3d-bar-server-0").Warnf("something %s", "odd")
+	done()
+
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d: %v", len(entries), entries)
+	}
+
+	expected := map[string]interface{}{
+		"@level":   "warn",
+		"@message": "something odd",
+		"cluster":  "bar",
+		"node":     "k3d-bar-server-0",
+		"source":   "k3d",
+	}
+	for k, v := range expected {
+		if entries[0][k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, entries[0][k])
+		}
+	}
+}
+
+func TestK3dLogScope(t *testing.T) {
+	current := func() context.Context {
+		k3dLogs.mu.Lock()
+		defer k3dLogs.mu.Unlock()
+		if len(k3dLogs.scopes) == 0 {
+			return nil
+		}
+		return k3dLogs.scopes[len(k3dLogs.scopes)-1].ctx
+	}
+
+	_, done := k3dLogScope(context.Background())
+
+	// other operations don't wait for the scope to be released
+	acquired := make(chan struct{})
+	var otherCtx context.Context
+	var otherDone func()
+	go func() {
+		otherCtx, otherDone = k3dLogScope(tflog.SetField(context.Background(), "node", "k3d-bar-server-0"))
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the other scope to be acquired")
+	}
+	if current() != otherCtx {
+		t.Error("expected the most recent scope to be current")
+	}
+
+	// scopes may be released in any order
+	done()
+	if current() != otherCtx {
+		t.Error("expected the other scope to stay current")
+	}
+	otherDone()
+	if current() != nil {
+		t.Error("expected no scope to be left")
+	}
+}
+
+func TestMaskK3dLogSecrets(t *testing.T) {
+	var output bytes.Buffer
+
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	installK3dLogHook(ctx)
+
+	masked := maskK3dLogSecrets(ctx, "s3cr3t", "")
+	// k3d entries are masked even when attributed to another operation
+	_, done := k3dLogScope(ctx)
+	l.Log().WithField("cmd", "k3s token rotate --token s3cr3t").Debugf("Executing command '%+v'", []string{"--token", "s3cr3t"})
+	done()
+	tflog.Debug(masked, "rotating s3cr3t")
+
+	if strings.Contains(output.String(), "s3cr3t") {
+		t.Errorf("expected the secret to be masked, got %s", output.String())
+	}
+	if strings.Count(output.String(), k3dLogMask) != 3 {
+		t.Errorf("expected 3 masked secrets, got %s", output.String())
+	}
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// forceNewIfMemoryLimitToggled replaces nodes when a memory limit is set or
+// removed: k3d only mounts the fake meminfo into memory limited nodes, mounts
+// can't be changed on an existing container and docker can't lift a limit.
+func forceNewIfMemoryLimitToggled(key string) schema.CustomizeDiffFunc {
+	return customdiff.ForceNewIfChange(key, func(ctx context.Context, old, new, meta interface{}) bool {
+		return (old.(string) == "") != (new.(string) == "")
+	})
+}
+
+// memoryEqual tells whether two docker memory limits are the same.
+func memoryEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	// k3d reports no limit as 0B
+	if a == "" {
+		a = "0"
+	}
+
+	aBytes, err := units.RAMInBytes(a)
+	if err != nil {
+		return false
+	}
+
+	return units.HumanSize(float64(aBytes)) == b
+}
+
+// makeFakeMemoryVolumes writes the fake /proc/meminfo (and edac folder) k3d
+// mounts into memory limited nodes so that k3s reports the limit as the node
+// capacity, and returns the mounts.
+func makeFakeMemoryVolumes(ctx context.Context, runtime providerRuntime, node *types.Node) ([]string, error) {
+	memory, err := units.RAMInBytes(node.Memory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory limit format: %w", err)
+	}
+
+	fakeMeminfoPath, err := util.MakeFakeMeminfo(memory, node.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fake meminfo: %w", err)
+	}
+	volumes := []string{fmt.Sprintf("%s:%s:ro", fakeMeminfoPath, util.MemInfoPath)}
+
+	exists, err := runtime.ImageHasDirectory(ctx, node.Image, util.EdacFolderPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for the existence of edac folder: %w", err)
+	}
+	if exists {
+		fakeEdacPath, err := util.MakeFakeEdac(node.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fake edac: %w", err)
+		}
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", fakeEdacPath, util.EdacFolderPath))
+	}
+
+	return volumes, nil
+}
+
+// isFakeMemoryVolume tells whether volume is one of the fake meminfo mounts.
+func isFakeMemoryVolume(volume string) bool {
+	parts := strings.Split(volume, ":")
+	return len(parts) > 1 && (parts[1] == util.MemInfoPath || parts[1] == util.EdacFolderPath)
+}
+
+// updateNodeMemory changes the memory limit of a running node in place. The
+// fake meminfo is regenerated and the node restarted for k3s to pick up the
+// new capacity, unless the limit is actually the same (e.g. 1g and 1024m).
+func updateNodeMemory(ctx context.Context, runtime runtimes.Runtime, node *types.Node, memory string) error {
+	if memoryEqual(memory, node.Memory) {
+		tflog.Debug(ctx, "Memory limit unchanged, skipping update", map[string]interface{}{"node": node.Name})
+		return nil
+	}
+
+	r, ok := asProviderRuntime(runtime)
+	if !ok {
+		return fmt.Errorf("updating the memory limit of node '%s' is not supported by the %s runtime", node.Name, runtime.ID())
+	}
+
+	memoryBytes, err := units.RAMInBytes(memory)
+	if err != nil {
+		return fmt.Errorf("invalid memory limit format: %w", err)
+	}
+
+	if err := r.UpdateNodeMemory(ctx, node, memoryBytes); err != nil {
+		return err
+	}
+
+	// the fake meminfo is bind mounted, rewriting it in place is enough
+	node.Memory = memory
+	if _, err := makeFakeMemoryVolumes(ctx, r, node); err != nil {
+		return err
+	}
+
+	if !node.State.Running {
+		return nil
+	}
+
+	tflog.Info(ctx, "Restarting node to apply the new memory limit", map[string]interface{}{"node": node.Name})
+
+	if err := runtime.StopNode(ctx, node); err != nil {
+		return fmt.Errorf("failed to stop node '%s': %w", node.Name, err)
+	}
+
+	startTime := time.Now().Truncate(time.Second)
+	if err := runtime.StartNode(ctx, node); err != nil {
+		return fmt.Errorf("failed to start node '%s': %w", node.Name, err)
+	}
+
+	if readyLogMessage := types.GetReadyLogMessage(node, types.IntentNodeStart); readyLogMessage != "" {
+		if err := client.NodeWaitForLogMessage(ctx, runtime, node, readyLogMessage, startTime); err != nil {
+			return fmt.Errorf("node '%s' failed to get ready: %w", node.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package provider
+
+import "testing"
+
+func TestMemoryEqual(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"", "", true},
+		{"1g", "1g", true},
+		{"1g", "1.074GB", true},
+		{"1024m", "1.074GB", true},
+		{"512m", "536.9MB", true},
+		{"1g", "536.9MB", false},
+		{"1g", "", false},
+		{"", "1.074GB", false},
+		{"", "0B", true},
+	}
+
+	for _, c := range cases {
+		if actual := memoryEqual(c.a, c.b); actual != c.expected {
+			t.Errorf("memoryEqual(%q, %q): expected %t, got %t", c.a, c.b, c.expected, actual)
+		}
+	}
+}
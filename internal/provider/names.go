@@ -0,0 +1,27 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// containerName returns the name of the container k3d runs for an object
+// (node, registry, ...) named name. Users may pass the name with or without
+// the k3d prefix, both refer to the same container.
+func containerName(name string) string {
+	prefix := types.DefaultObjectNamePrefix + "-"
+	if strings.HasPrefix(name, prefix) {
+		return name
+	}
+
+	return prefix + name
+}
+
+// suppressEquivalentContainerName ignores changes between names referring to
+// the same container, e.g. "foo" and "k3d-foo".
+func suppressEquivalentContainerName(k, old, new string, d *schema.ResourceData) bool {
+	return containerName(old) == containerName(new)
+}
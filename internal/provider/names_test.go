@@ -0,0 +1,27 @@
+package provider
+
+import "testing"
+
+func TestContainerName(t *testing.T) {
+	cases := map[string]string{
+		"foo":         "k3d-foo",
+		"k3d-foo":     "k3d-foo",
+		"k3d-k3d-foo": "k3d-k3d-foo",
+		"k3dfoo":      "k3d-k3dfoo",
+	}
+
+	for name, expected := range cases {
+		if actual := containerName(name); actual != expected {
+			t.Errorf("containerName(%q): expected %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestSuppressEquivalentContainerName(t *testing.T) {
+	if !suppressEquivalentContainerName("name", "foo", "k3d-foo", nil) {
+		t.Errorf("expected foo and k3d-foo to be equivalent")
+	}
+	if suppressEquivalentContainerName("name", "foo", "bar", nil) {
+		t.Errorf("expected foo and bar to differ")
+	}
+}
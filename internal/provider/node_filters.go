@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// nodeFilterRoles maps the groups of node filters to the roles of the nodes
+// they select, "all" selects every node.
+var nodeFilterRoles = map[string]types.Role{
+	"server":       types.ServerRole,
+	"servers":      types.ServerRole,
+	"agent":        types.AgentRole,
+	"agents":       types.AgentRole,
+	"loadbalancer": types.LoadBalancerRole,
+}
+
+// nodeFilterKeys are the blocks of the cluster resource with node filters.
+var nodeFilterKeys = []string{"env", "file", "k3s.0.extra_args", "label", "port", "volume"}
+
+// portNodeFilterSuffixes are the suffixes k3d allows in the node filters of
+// ports, to pick how the load balancer forwards them.
+var portNodeFilterSuffixes = []string{"proxy", "direct"}
+
+type nodeFilter struct {
+	group  string
+	subset string
+	suffix string
+}
+
+// parseNodeFilter parses a node filter like k3d does, e.g. agent:0,1 or
+// loadbalancer:proxy.
+func parseNodeFilter(filter string) (*nodeFilter, error) {
+	match := util.NodeFilterRegexp.FindStringSubmatch(filter)
+	if len(match) == 0 {
+		return nil, fmt.Errorf("invalid node filter %q: must be GROUP[:SUBSET][:SUFFIX], the group being server, agent, loadbalancer or all and the subset a list (0,1), a range (0-2) or *", filter)
+	}
+
+	submatches := util.MapSubexpNames(util.NodeFilterRegexp.SubexpNames(), match)
+	f := &nodeFilter{
+		group:  submatches["group"],
+		subset: submatches["subset"],
+		suffix: submatches["suffix"],
+	}
+
+	// k3d only picks nodes among servers and agents through a subset
+	if role := nodeFilterRoles[f.group]; f.subset == "" && (role == types.ServerRole || role == types.AgentRole) {
+		return nil, fmt.Errorf("invalid node filter %q: the %s group needs a subset, e.g. %s:0 or %s:*", filter, f.group, f.group, f.group)
+	}
+
+	return f, nil
+}
+
+// checkIndices checks that the subset of f only selects some of the count
+// nodes of its group. The errors tell which attribute sets the count and the
+// indices available, e.g. "agents = 2, indices go from 0 to 1".
+func (f *nodeFilter) checkIndices(count int) error {
+	role := nodeFilterRoles[f.group]
+	available := fmt.Sprintf("%ss = %d, indices go from 0 to %d", role, count, count-1)
+	switch count {
+	case 0:
+		available = fmt.Sprintf("%ss = 0, there is no %s to select", role, role)
+	case 1:
+		available = fmt.Sprintf("%ss = 1, the only index is 0", role)
+	}
+
+	if strings.Contains(f.subset, "-") {
+		start, end := 0, count-1
+		bounds := strings.SplitN(f.subset, "-", 2)
+		if bounds[0] != "" {
+			start, _ = strconv.Atoi(bounds[0])
+			if start >= count {
+				return fmt.Errorf("range %s starts out of range: %s", f.subset, available)
+			}
+		}
+		if bounds[1] != "" {
+			end, _ = strconv.Atoi(bounds[1])
+			if end < start {
+				return fmt.Errorf("range %s ends before it starts", f.subset)
+			}
+			if end >= count {
+				return fmt.Errorf("range %s ends out of range: %s", f.subset, available)
+			}
+		}
+
+		return nil
+	}
+
+	if f.subset == "*" || f.subset == "" {
+		return nil
+	}
+
+	for _, i := range strings.Split(f.subset, ",") {
+		if i == "" {
+			continue
+		}
+		if index, _ := strconv.Atoi(i); index >= count {
+			return fmt.Errorf("index %d out of range: %s", index, available)
+		}
+	}
+
+	return nil
+}
+
+// checkSuffix checks that the suffix of f, the parsed filter, is one of
+// suffixes.
+func (f *nodeFilter) checkSuffix(filter string, suffixes []string) error {
+	if f.suffix == "" || slices.Contains(suffixes, f.suffix) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Suffix %q is not allowed in node filter %q.", f.suffix, filter)
+	if len(suffixes) > 0 {
+		msg = fmt.Sprintf("%s It must be one of %s.", msg, strings.Join(suffixes, ", "))
+	}
+
+	return errors.New(msg)
+}
+
+// checkNodes checks that f only selects some of the nodes of a cluster with
+// counts servers and agents, and not its load balancer if disabled.
+func (f *nodeFilter) checkNodes(counts map[types.Role]int, loadBalancerDisabled bool) error {
+	switch role := nodeFilterRoles[f.group]; role {
+	case types.ServerRole, types.AgentRole:
+		return f.checkIndices(counts[role])
+	case types.LoadBalancerRole:
+		if loadBalancerDisabled {
+			return errors.New("the load balancer is disabled")
+		}
+	}
+
+	return nil
+}
+
+// validateNodeFilter checks the syntax of node filters, only the given
+// suffixes being allowed.
+func validateNodeFilter(suffixes ...string) schema.SchemaValidateDiagFunc {
+	return func(v interface{}, p cty.Path) diag.Diagnostics {
+		f, err := parseNodeFilter(v.(string))
+		if err != nil {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid node filter",
+				Detail:        err.Error(),
+				AttributePath: p,
+			}}
+		}
+
+		if err := f.checkSuffix(v.(string), suffixes); err != nil {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Invalid node filter",
+				Detail:        err.Error(),
+				AttributePath: p,
+			}}
+		}
+
+		return nil
+	}
+}
+
+// validateNodeFilterIndices checks that the node filters only select existing
+// servers and agents, and not a disabled load balancer. The errors point at
+// the faulty filter, e.g. port.0.node_filters.1.
+func validateNodeFilterIndices(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("servers") || !d.NewValueKnown("agents") {
+		return nil
+	}
+
+	counts := map[types.Role]int{
+		types.ServerRole: d.Get("servers").(int),
+		types.AgentRole:  d.Get("agents").(int),
+	}
+	loadBalancerDisabled := d.Get("k3d.0.disable_load_balancer").(bool)
+
+	var errs []error
+	for _, key := range nodeFilterKeys {
+		for i := range d.Get(key).([]interface{}) {
+			filtersKey := fmt.Sprintf("%s.%d.node_filters", key, i)
+			for j, filter := range d.Get(filtersKey).([]interface{}) {
+				filterKey := fmt.Sprintf("%s.%d", filtersKey, j)
+				if !d.NewValueKnown(filterKey) {
+					continue
+				}
+
+				// syntax errors are reported by validateNodeFilter
+				f, err := parseNodeFilter(filter.(string))
+				if err != nil {
+					continue
+				}
+
+				if err := f.checkNodes(counts, loadBalancerDisabled); err != nil {
+					errs = append(errs, fmt.Errorf("%s: node filter %q: %w", filterKey, filter, err))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
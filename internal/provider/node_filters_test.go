@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestParseNodeFilter(t *testing.T) {
+	cases := []struct {
+		filter   string
+		expected *nodeFilter
+	}{
+		{filter: "server:0", expected: &nodeFilter{group: "server", subset: "0"}},
+		{filter: "agents:0,2", expected: &nodeFilter{group: "agents", subset: "0,2"}},
+		{filter: "agent:1-", expected: &nodeFilter{group: "agent", subset: "1-"}},
+		{filter: "agent:*:proxy", expected: &nodeFilter{group: "agent", subset: "*", suffix: "proxy"}},
+		{filter: "loadbalancer", expected: &nodeFilter{group: "loadbalancer"}},
+		{filter: "all", expected: &nodeFilter{group: "all"}},
+		{filter: "server"},
+		{filter: "agent:direct"},
+		{filter: "agents[0]"},
+		{filter: "agent[*]:0"},
+		{filter: "worker:0"},
+		{filter: ""},
+	}
+
+	for _, c := range cases {
+		f, err := parseNodeFilter(c.filter)
+		if c.expected == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", c.filter, f)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.filter, err)
+			continue
+		}
+		if *f != *c.expected {
+			t.Errorf("%q: expected %+v, got %+v", c.filter, c.expected, f)
+		}
+	}
+}
+
+func TestNodeFilterCheckIndices(t *testing.T) {
+	cases := []struct {
+		filter string
+		count  int
+		valid  bool
+	}{
+		{filter: "agent:*", count: 0, valid: true},
+		{filter: "agent:0", count: 1, valid: true},
+		{filter: "agent:1", count: 1},
+		{filter: "agent:0,1,2", count: 3, valid: true},
+		{filter: "agent:0,3", count: 3},
+		{filter: "agent:0-2", count: 3, valid: true},
+		{filter: "agent:0-3", count: 3},
+		{filter: "agent:2-1", count: 3},
+		{filter: "agent:2-", count: 3, valid: true},
+		{filter: "agent:3-", count: 3},
+		{filter: "agent:-2", count: 3, valid: true},
+		{filter: "agent:-", count: 3, valid: true},
+	}
+
+	for _, c := range cases {
+		f, err := parseNodeFilter(c.filter)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", c.filter, err)
+		}
+
+		if err := f.checkIndices(c.count); (err == nil) != c.valid {
+			t.Errorf("%q with %d nodes: expected valid to be %t, got error %v", c.filter, c.count, c.valid, err)
+		}
+	}
+}
+
+func TestValidateNodeFilter(t *testing.T) {
+	p := cty.GetAttrPath("port").IndexInt(0).GetAttr("node_filters").IndexInt(1)
+
+	if diags := validateNodeFilter()("server:0", p); diags.HasError() {
+		t.Errorf("unexpected error: %v", diags)
+	}
+
+	diags := validateNodeFilter()("agents[0]", p)
+	if len(diags) != 1 {
+		t.Fatalf("expected an error, got %v", diags)
+	}
+	if !diags[0].AttributePath.Equals(p) {
+		t.Errorf("expected the error at %#v, got %#v", p, diags[0].AttributePath)
+	}
+
+	if diags := validateNodeFilter()("loadbalancer:proxy", p); !diags.HasError() {
+		t.Error("expected an error for a suffix out of ports")
+	}
+	if diags := validateNodeFilter(portNodeFilterSuffixes...)("loadbalancer:proxy", p); diags.HasError() {
+		t.Errorf("unexpected error: %v", diags)
+	}
+	if diags := validateNodeFilter(portNodeFilterSuffixes...)("loadbalancer:foo", p); !diags.HasError() {
+		t.Error("expected an error for an unknown suffix")
+	}
+}
+
+func TestResourceCluster_validateNodeFilters(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		expected string
+	}{
+		{
+			raw: map[string]interface{}{
+				"name":   "foo",
+				"agents": 2,
+				"env": []interface{}{
+					map[string]interface{}{"key": "FOO", "node_filters": []interface{}{"server:0", "agent:0,1"}},
+				},
+			},
+		},
+		{
+			raw: map[string]interface{}{
+				"name":   "foo",
+				"agents": 2,
+				"label": []interface{}{
+					map[string]interface{}{"key": "foo", "node_filters": []interface{}{"agent:*"}},
+					map[string]interface{}{"key": "bar", "node_filters": []interface{}{"server:0", "agent:2"}},
+				},
+			},
+			expected: `label.1.node_filters.1: node filter "agent:2": index 2 out of range: agents = 2, indices go from 0 to 1`,
+		},
+		{
+			raw: map[string]interface{}{
+				"name":    "foo",
+				"servers": 3,
+				"k3s": []interface{}{
+					map[string]interface{}{
+						"extra_args": []interface{}{
+							map[string]interface{}{"arg": "--foo", "node_filters": []interface{}{"server:1-3"}},
+						},
+					},
+				},
+			},
+			expected: `k3s.0.extra_args.0.node_filters.0: node filter "server:1-3": range 1-3 ends out of range: servers = 3, indices go from 0 to 2`,
+		},
+		{
+			raw: map[string]interface{}{
+				"name": "foo",
+				"k3d": []interface{}{
+					map[string]interface{}{"disable_load_balancer": true},
+				},
+				"port": []interface{}{
+					map[string]interface{}{"container_port": 80, "node_filters": []interface{}{"loadbalancer"}},
+				},
+			},
+			expected: `port.0.node_filters.0: node filter "loadbalancer": the load balancer is disabled`,
+		},
+		{
+			raw: map[string]interface{}{
+				"name": "foo",
+				"volume": []interface{}{
+					map[string]interface{}{"source": "/data", "destination": "/data", "node_filters": []interface{}{"agent:0"}},
+				},
+			},
+			expected: `volume.0.node_filters.0: node filter "agent:0": index 0 out of range: agents = 0, there is no agent to select`,
+		},
+	}
+
+	for i, c := range cases {
+		_, err := resourceCluster().Diff(context.Background(), &terraform.InstanceState{}, terraform.NewResourceConfigRaw(c.raw), testMeta(newFakeRuntime()))
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %s", i, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%d: expected error %q, got %v", i, c.expected, err)
+		}
+	}
+}
+
+func TestResourceCluster_validateNodeFilterSyntax(t *testing.T) {
+	raw := map[string]interface{}{
+		"name": "foo",
+		"volume": []interface{}{
+			map[string]interface{}{"destination": "/foo", "node_filters": []interface{}{"server:0", "agents[0]"}},
+		},
+	}
+
+	diags := resourceCluster().Validate(terraform.NewResourceConfigRaw(raw))
+	if len(diags) != 1 {
+		t.Fatalf("expected an error, got %v", diags)
+	}
+
+	expected := cty.GetAttrPath("volume").IndexInt(0).GetAttr("node_filters").IndexInt(1)
+	if !diags[0].AttributePath.Equals(expected) {
+		t.Errorf("expected the error at %#v, got %#v", expected, diags[0].AttributePath)
+	}
+}
+
+func TestNodeFilterErrors_functionAndResource(t *testing.T) {
+	// parse_port_mapping reports the mistakes the cluster resource does, in
+	// the same terms
+	cases := []struct {
+		filter          string
+		servers, agents int
+		// the count attribute and the valid indices
+		available string
+	}{
+		{filter: "agent:2", servers: 1, agents: 2, available: "agents = 2, indices go from 0 to 1"},
+		{filter: "server:1-3", servers: 3, available: "servers = 3, indices go from 0 to 2"},
+		{filter: "agent:0", servers: 1, available: "agents = 0, there is no agent to select"},
+		{filter: "agent", servers: 1, agents: 1},
+		{filter: "agents[0]", servers: 1},
+		{filter: "loadbalancer:nope", servers: 1},
+	}
+
+	for _, c := range cases {
+		mapping := "8080:80@" + c.filter
+		_, funcErr := testRunFunction(t, newParsePortMappingFunction, fwtypes.StringValue(mapping), testNodeCounts(map[string]int64{"servers": int64(c.servers), "agents": int64(c.agents)}))
+		if funcErr == nil {
+			t.Errorf("%s: expected an error from the function", c.filter)
+			continue
+		}
+		expected := strings.TrimPrefix(funcErr.Text, fmt.Sprintf("Invalid port mapping %q: ", mapping))
+		if !strings.Contains(expected, c.available) {
+			t.Errorf("%s: expected the function to report %q, got %q", c.filter, c.available, expected)
+		}
+
+		raw := map[string]interface{}{
+			"name":    "foo",
+			"servers": c.servers,
+			"agents":  c.agents,
+			"port": []interface{}{
+				map[string]interface{}{"host_port": 8080, "container_port": 80, "node_filters": []interface{}{c.filter}},
+			},
+		}
+		config := terraform.NewResourceConfigRaw(raw)
+		var actual string
+		if diags := resourceCluster().Validate(config); diags.HasError() {
+			actual = diags[0].Detail
+		} else if _, err := resourceCluster().Diff(context.Background(), &terraform.InstanceState{}, config, testMeta(newFakeRuntime())); err != nil {
+			actual = err.Error()
+		}
+
+		if !strings.Contains(actual, expected) {
+			t.Errorf("%s: expected the resource to report %q, got %q", c.filter, expected, actual)
+		}
+	}
+}
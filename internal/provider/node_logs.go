@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// defaultNodeLogsLines is the number of lines of logs of a failed node
+// attached to the diagnostics, unless configured otherwise.
+const defaultNodeLogsLines = 20
+
+// nodeLogs returns the logs of node, of stopped nodes too if the runtime
+// serves them.
+func nodeLogs(ctx context.Context, runtime runtimes.Runtime, node *types.Node) (string, error) {
+	if r, ok := asProviderRuntime(runtime); ok {
+		return r.GetAllNodeLogs(ctx, node)
+	}
+
+	reader, err := runtime.GetNodeLogs(ctx, node, time.Time{}, &runtimeTypes.NodeLogsOpts{})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	logs, err := io.ReadAll(reader)
+	return string(logs), err
+}
+
+// tailLines returns the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// failedNodes returns the nodes carrying labels that err names or that
+// aren't running.
+func failedNodes(ctx context.Context, runtime runtimes.Runtime, labels map[string]string, err error) []*types.Node {
+	nodes, listErr := runtime.GetNodesByLabel(ctx, labels)
+	if listErr != nil {
+		return nil
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	var failed []*types.Node
+	for _, node := range nodes {
+		if namedInError(err, node.Name) || !node.State.Running {
+			failed = append(failed, node)
+		}
+	}
+
+	return failed
+}
+
+// namedInError reports whether err mentions the container name as a whole,
+// k3d-foo-server-1 isn't named by an error about k3d-foo-server-10.
+func namedInError(err error, name string) bool {
+	words := strings.FieldsFunc(err.Error(), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_.-", r)
+	})
+	for _, word := range words {
+		// the name may end a sentence
+		if strings.TrimRight(word, ".") == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nodeLogsDiagnostics returns a warning with the last lines logged by each
+// of nodes, and writes their complete logs to the node logs directory of c,
+// if any.
+func nodeLogsDiagnostics(ctx context.Context, c *apiClient, nodes []*types.Node) diag.Diagnostics {
+	lines := c.nodeLogsLines
+	if lines == 0 {
+		lines = defaultNodeLogsLines
+	}
+
+	var diags diag.Diagnostics
+	for _, node := range nodes {
+		logs, err := nodeLogs(ctx, c.runtime, node)
+		if err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Last logs of node %s", node.Name),
+				Detail:   fmt.Sprintf("Logs unavailable: %s", err),
+			})
+			continue
+		}
+
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Last logs of node %s", node.Name),
+			Detail:   tailLines(logs, lines),
+		})
+
+		if c.nodeLogsDir != "" {
+			if err := writeNodeLogs(c.nodeLogsDir, node.Name, logs); err != nil {
+				diags = append(diags, diag.Diagnostic{
+					Severity: diag.Warning,
+					Summary:  fmt.Sprintf("Failed to write logs of node %s", node.Name),
+					Detail:   err.Error(),
+				})
+			}
+		}
+	}
+
+	return diags
+}
+
+// writeNodeLogs writes logs to <dir>/<nodeName>.log.
+func writeNodeLogs(dir string, nodeName string, logs string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, nodeName+".log"), []byte(logs), 0644)
+}
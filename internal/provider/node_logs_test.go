@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestTailLines(t *testing.T) {
+	tests := []struct {
+		logs     string
+		expected string
+	}{
+		{"", ""},
+		{"a\nb\n", "a\nb"},
+		{"a\nb\nc\nd\n", "c\nd"},
+		{"a\nb\nc", "b\nc"},
+	}
+
+	for _, test := range tests {
+		if actual := tailLines(test.logs, 2); actual != test.expected {
+			t.Errorf("tailLines(%q): expected %q, got %q", test.logs, test.expected, actual)
+		}
+	}
+}
+
+func TestFailedNodes(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	for _, name := range []string{"k3d-foo-server-1", "k3d-foo-server-10", "k3d-foo-agent-0", "k3d-foo-serverlb"} {
+		node := &types.Node{Name: name, RuntimeLabels: map[string]string{types.LabelClusterName: "foo"}}
+		if err := runtime.CreateNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		if name != "k3d-foo-agent-0" {
+			if err := runtime.StartNode(ctx, node); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	names := func(nodes []*types.Node) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	labels := map[string]string{types.LabelClusterName: "foo"}
+	actual := names(failedNodes(ctx, runtime, labels, errors.New("Failed to start server k3d-foo-server-10: timeout")))
+	if expected := []string{"k3d-foo-agent-0", "k3d-foo-server-10"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual = names(failedNodes(ctx, runtime, labels, errors.New("failed to run node 'k3d-foo-server-1'. Aborting")))
+	if expected := []string{"k3d-foo-agent-0", "k3d-foo-server-1"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual = names(failedNodes(ctx, runtime, labels, errors.New("context deadline exceeded")))
+	if expected := []string{"k3d-foo-agent-0"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNodeLogsDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	node := &types.Node{Name: "k3d-foo-server-0", Role: types.ServerRole}
+	if err := runtime.CreateNode(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	runtime.logs[node.Name] = []string{"starting k3s", "level=fatal msg=\"invalid flag\""}
+
+	dir := filepath.Join(t.TempDir(), "logs")
+	c := &apiClient{runtime: runtime, nodeLogsDir: dir, nodeLogsLines: 1}
+	diags := nodeLogsDiagnostics(ctx, c, []*types.Node{node, {Name: "k3d-foo-agent-0"}})
+
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diags)
+	}
+	if diags[0].Summary != "Last logs of node k3d-foo-server-0" || diags[0].Detail != "level=fatal msg=\"invalid flag\"" {
+		t.Errorf("unexpected diagnostic: %s: %s", diags[0].Summary, diags[0].Detail)
+	}
+	if !strings.HasPrefix(diags[1].Detail, "Logs unavailable: ") {
+		t.Errorf("unexpected diagnostic: %s: %s", diags[1].Summary, diags[1].Detail)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "k3d-foo-server-0.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "starting k3s\nlevel=fatal msg=\"invalid flag\"\n" {
+		t.Errorf("unexpected logs: %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "k3d-foo-agent-0.log")); !os.IsNotExist(err) {
+		t.Errorf("expected no logs for the unknown node, got %v", err)
+	}
+}
@@ -2,9 +2,18 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-mux/tf5to6server"
+	"github.com/hashicorp/terraform-plugin-mux/tf6muxserver"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 )
 
 func init() {
@@ -26,15 +35,27 @@ func init() {
 func New(version string) func() *schema.Provider {
 	return func() *schema.Provider {
 		p := &schema.Provider{
+			Schema: map[string]*schema.Schema{
+				"node_logs_dir": {
+					Description: nodeLogsDirDescription,
+					Optional:    true,
+					Type:        schema.TypeString,
+				},
+				"node_logs_lines": {
+					Description: nodeLogsLinesDescription,
+					Optional:    true,
+					Type:        schema.TypeInt,
+				},
+			},
 			DataSourcesMap: map[string]*schema.Resource{
-				"k3d_cluster":  dataSourceCluster(),
-				"k3d_node":     dataSourceNode(),
-				"k3d_registry": dataSourceRegistry(),
+				"k3d_cluster": dataSourceCluster(),
+				"k3d_node":    dataSourceNode(),
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"k3d_cluster":  resourceCluster(),
-				"k3d_node":     resourceNode(),
-				"k3d_registry": resourceRegistry(),
+				"k3d_cluster":       resourceCluster(),
+				"k3d_etcd_snapshot": resourceEtcdSnapshot(),
+				"k3d_node":          resourceNode(),
+				"k3d_node_pool":     resourceNodePool(),
 			},
 		}
 
@@ -44,18 +65,83 @@ func New(version string) func() *schema.Provider {
 	}
 }
 
+// NewMuxServer serves the resources still built on the SDK and the ones moved
+// to the plugin framework (see NewFramework) as a single provider, over
+// protocol version 6.
+func NewMuxServer(ctx context.Context, version string) (func() tfprotov6.ProviderServer, error) {
+	sdkServer, err := tf5to6server.UpgradeServer(ctx, New(version)().GRPCProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	muxServer, err := tf6muxserver.NewMuxServer(ctx,
+		func() tfprotov6.ProviderServer { return sdkServer },
+		providerserver.NewProtocol6(NewFramework(version)()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return muxServer.ProviderServer, nil
+}
+
+// The provider configuration, shared by the SDK and the framework providers.
+const (
+	nodeLogsDirDescription   = "Directory the complete logs of the nodes failing to start are written to, as `<container name>.log`, e.g. to keep them as CI artifacts. Can be set with the `K3D_NODE_LOGS_DIR` environment variable."
+	nodeLogsLinesDescription = "Number of lines of logs of the nodes failing to start reported along with the error. Can be set with the `K3D_NODE_LOGS_LINES` environment variable. Defaults to `20`."
+)
+
 type apiClient struct {
-	// Add whatever fields, client or connection info, etc. here
-	// you would need to setup to communicate with the upstream
-	// API.
+	// runtime manages the containers, networks and volumes of k3d. It is
+	// the selected k3d runtime, unless replaced, e.g. by a fake in tests.
+	runtime runtimes.Runtime
+
+	// nodeLogsDir is where the logs of failed nodes are written, if set.
+	nodeLogsDir string
+	// nodeLogsLines is the number of lines of logs of failed nodes
+	// reported, defaultNodeLogsLines if zero.
+	nodeLogsLines int
+}
+
+// newAPIClient returns the client of a provider configured with
+// nodeLogsDir and nodeLogsLines, the environment filling in unset ones.
+func newAPIClient(nodeLogsDir string, nodeLogsLines int) (*apiClient, error) {
+	if nodeLogsDir == "" {
+		nodeLogsDir = os.Getenv("K3D_NODE_LOGS_DIR")
+	}
+	if nodeLogsLines == 0 {
+		if env := os.Getenv("K3D_NODE_LOGS_LINES"); env != "" {
+			lines, err := strconv.Atoi(env)
+			if err != nil {
+				return nil, fmt.Errorf("invalid K3D_NODE_LOGS_LINES: %w", err)
+			}
+			nodeLogsLines = lines
+		}
+	}
+	if nodeLogsLines < 0 {
+		return nil, fmt.Errorf("node_logs_lines must not be negative, got %d", nodeLogsLines)
+	}
+
+	return &apiClient{
+		runtime:       runtimes.SelectedRuntime,
+		nodeLogsDir:   nodeLogsDir,
+		nodeLogsLines: nodeLogsLines,
+	}, nil
 }
 
 func configure(version string, p *schema.Provider) func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	return func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+		installK3dLogHook(ctx)
+
 		// Setup a User-Agent for your API client (replace the provider name for yours):
 		// userAgent := p.UserAgent("terraform-provider-k3d", version)
 		// TODO: myClient.UserAgent = userAgent
 
-		return &apiClient{}, nil
+		c, err := newAPIClient(d.Get("node_logs_dir").(string), d.Get("node_logs_lines").(int))
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+
+		return c, nil
 	}
 }
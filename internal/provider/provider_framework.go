@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	fwprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+	providerschema "github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var _ fwprovider.ProviderWithFunctions = &frameworkProvider{}
+
+// frameworkProvider serves the resources and data sources moved to the plugin
+// framework and the provider-defined functions. It is muxed with the SDK
+// provider, both must keep the same configuration.
+type frameworkProvider struct {
+	version string
+}
+
+type frameworkProviderModel struct {
+	NodeLogsDir   fwtypes.String `tfsdk:"node_logs_dir"`
+	NodeLogsLines fwtypes.Int64  `tfsdk:"node_logs_lines"`
+}
+
+func NewFramework(version string) func() fwprovider.Provider {
+	return func() fwprovider.Provider {
+		return &frameworkProvider{version: version}
+	}
+}
+
+func (p *frameworkProvider) Metadata(ctx context.Context, req fwprovider.MetadataRequest, resp *fwprovider.MetadataResponse) {
+	resp.TypeName = "k3d"
+	resp.Version = p.version
+}
+
+func (p *frameworkProvider) Schema(ctx context.Context, req fwprovider.SchemaRequest, resp *fwprovider.SchemaResponse) {
+	resp.Schema = providerschema.Schema{
+		Attributes: map[string]providerschema.Attribute{
+			"node_logs_dir": providerschema.StringAttribute{
+				MarkdownDescription: nodeLogsDirDescription,
+				Optional:            true,
+			},
+			"node_logs_lines": providerschema.Int64Attribute{
+				MarkdownDescription: nodeLogsLinesDescription,
+				Optional:            true,
+			},
+		},
+	}
+}
+
+func (p *frameworkProvider) Configure(ctx context.Context, req fwprovider.ConfigureRequest, resp *fwprovider.ConfigureResponse) {
+	installK3dLogHook(ctx)
+
+	var config frameworkProviderModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := newAPIClient(config.NodeLogsDir.ValueString(), int(config.NodeLogsLines.ValueInt64()))
+	if err != nil {
+		resp.Diagnostics.AddError("Invalid provider configuration", err.Error())
+		return
+	}
+	resp.DataSourceData = client
+	resp.ResourceData = client
+}
+
+func (p *frameworkProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
+	return []func() datasource.DataSource{
+		newRegistryDataSource,
+	}
+}
+
+func (p *frameworkProvider) Resources(ctx context.Context) []func() resource.Resource {
+	return []func() resource.Resource{
+		newNetworkResource,
+		newRegistryResource,
+		newVolumeResource,
+	}
+}
+
+func (p *frameworkProvider) Functions(ctx context.Context) []func() function.Function {
+	return []func() function.Function{
+		newContainerNameFunction,
+		newNodeFilterFunction,
+		newParsePortMappingFunction,
+	}
+}
+
+// configureClient returns the client the provider was configured with, for
+// the Configure method of resources. It is nil until the provider is
+// configured.
+func configureClient(providerData any, diags *diag.Diagnostics) *apiClient {
+	if providerData == nil {
+		return nil
+	}
+
+	client, ok := providerData.(*apiClient)
+	if !ok {
+		diags.AddError("Unexpected provider data", fmt.Sprintf("Expected *apiClient, got %T. Please report this issue to the provider developers.", providerData))
+		return nil
+	}
+
+	return client
+}
+
+// idAttribute is the id attribute of resources, as the SDK had them, so that
+// their states carry over.
+func idAttribute() schema.StringAttribute {
+	return schema.StringAttribute{
+		MarkdownDescription: "The ID of this resource.",
+		Computed:            true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+}
@@ -1,28 +1,184 @@
 package provider
 
 import (
+	"context"
+	"errors"
+	"log"
+	"strings"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
-// providerFactories are used to instantiate a provider during acceptance testing.
+// testAccNamePrefix prefixes the random names of the objects created by
+// acceptance tests, the sweepers delete whatever carries it.
+const testAccNamePrefix = "tf-acc-test"
+
+// protoV6ProviderFactories are used to instantiate a provider during acceptance testing.
 // The factory function will be invoked for every Terraform CLI command executed
 // to create a provider server to which the CLI can reattach.
-var providerFactories = map[string]func() (*schema.Provider, error){
-	"k3d": func() (*schema.Provider, error) {
-		return New("dev")(), nil
+var protoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServer, error){
+	"k3d": func() (tfprotov6.ProviderServer, error) {
+		serverFactory, err := NewMuxServer(context.Background(), "dev")
+		if err != nil {
+			return nil, err
+		}
+
+		return serverFactory(), nil
 	},
 }
 
+// TestMain runs the sweepers when asked to with -sweep, e.g.
+// go test ./internal/provider -v -sweep=all, and the tests otherwise.
+func TestMain(m *testing.M) {
+	resource.TestMain(m)
+}
+
 func TestProvider(t *testing.T) {
 	if err := New("dev")().InternalValidate(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 }
 
+func TestMuxServer(t *testing.T) {
+	ctx := context.Background()
+
+	serverFactory, err := NewMuxServer(ctx, "dev")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	resp, err := serverFactory().GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, d := range resp.Diagnostics {
+		if d.Severity == tfprotov6.DiagnosticSeverityError {
+			t.Errorf("unexpected error: %s: %s", d.Summary, d.Detail)
+		}
+	}
+
+	for _, name := range []string{"k3d_cluster", "k3d_network", "k3d_registry", "k3d_volume"} {
+		if _, ok := resp.ResourceSchemas[name]; !ok {
+			t.Errorf("expected a schema for %s", name)
+		}
+	}
+	for _, name := range []string{"k3d_cluster", "k3d_node", "k3d_registry"} {
+		if _, ok := resp.DataSourceSchemas[name]; !ok {
+			t.Errorf("expected a data source schema for %s", name)
+		}
+	}
+	for _, name := range []string{"container_name", "node_filter", "parse_port_mapping"} {
+		if _, ok := resp.Functions[name]; !ok {
+			t.Errorf("expected a function %s", name)
+		}
+	}
+}
+
+func TestNewAPIClient(t *testing.T) {
+	t.Setenv("K3D_NODE_LOGS_DIR", "/tmp/env-logs")
+	t.Setenv("K3D_NODE_LOGS_LINES", "50")
+
+	c, err := newAPIClient("", 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.nodeLogsDir != "/tmp/env-logs" || c.nodeLogsLines != 50 {
+		t.Errorf("expected the environment values, got %q and %d", c.nodeLogsDir, c.nodeLogsLines)
+	}
+
+	c, err = newAPIClient("/tmp/logs", 5)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.nodeLogsDir != "/tmp/logs" || c.nodeLogsLines != 5 {
+		t.Errorf("expected the configured values, got %q and %d", c.nodeLogsDir, c.nodeLogsLines)
+	}
+
+	if _, err := newAPIClient("", -1); err == nil {
+		t.Error("expected an error for a negative number of lines")
+	}
+
+	t.Setenv("K3D_NODE_LOGS_LINES", "many")
+	if _, err := newAPIClient("", 0); err == nil {
+		t.Error("expected an error for an invalid K3D_NODE_LOGS_LINES")
+	}
+}
+
+// testRunFunction runs the function built by newFunction with args.
+func testRunFunction(t *testing.T, newFunction func() function.Function, args ...attr.Value) (attr.Value, *function.FuncError) {
+	t.Helper()
+
+	ctx := context.Background()
+	f := newFunction()
+
+	var definitionResp function.DefinitionResponse
+	f.Definition(ctx, function.DefinitionRequest{}, &definitionResp)
+	if definitionResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", definitionResp.Diagnostics)
+	}
+
+	result, funcErr := definitionResp.Definition.Return.NewResultData(ctx)
+	if funcErr != nil {
+		t.Fatalf("unexpected error: %s", funcErr)
+	}
+
+	resp := function.RunResponse{Result: result}
+	f.Run(ctx, function.RunRequest{Arguments: function.NewArgumentsData(args)}, &resp)
+
+	return resp.Result.Value(), resp.Error
+}
+
 func testAccPreCheck(t *testing.T) {
 	// You can add code here to run prior to any test case execution, for example assertions
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+// sweepNodes deletes the nodes of the given roles left behind by acceptance
+// tests.
+func sweepNodes(roles ...types.Role) error {
+	ctx := context.Background()
+
+	nodes, err := client.NodeList(ctx, runtimes.SelectedRuntime)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, node := range nodes {
+		if !isSweepable(node.Name) || !hasRole(node, roles) {
+			continue
+		}
+
+		log.Printf("[INFO] Deleting %s node %s", node.Role, node.Name)
+		if err := client.NodeDelete(ctx, runtimes.SelectedRuntime, node, types.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isSweepable tells whether the object named name was created by acceptance
+// tests, with or without the k3d prefix.
+func isSweepable(name string) bool {
+	return strings.HasPrefix(name, testAccNamePrefix) || strings.HasPrefix(name, containerName(testAccNamePrefix))
+}
+
+func hasRole(node *types.Node, roles []types.Role) bool {
+	for _, role := range roles {
+		if node.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
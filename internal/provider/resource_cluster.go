@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	types2 "github.com/k3d-io/k3d/v5/pkg/config/types"
@@ -13,31 +18,46 @@ import (
 
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
 
 	"github.com/k3d-io/k3d/v5/cmd/util"
 	"github.com/k3d-io/k3d/v5/pkg/client"
 	"github.com/k3d-io/k3d/v5/pkg/config"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
-	"github.com/k3d-io/k3d/v5/version"
+	"github.com/k3d-io/k3d/v5/pkg/types/k3s"
 )
 
 func resourceCluster() *schema.Resource {
-
-	k3sVersion, err := version.GetK3sVersion("stable")
-	if err != nil {
-		panic(err)
-	}
-
 	return &schema.Resource{
 		// This description is used by the documentation generator and the language server.
 		Description: "Cluster resource in k3d.",
 
 		CreateContext: resourceClusterCreate,
 		ReadContext:   resourceClusterRead,
-		// UpdateContext: resourceClusterUpdate,
+		UpdateContext: resourceClusterUpdate,
 		DeleteContext: resourceClusterDelete,
 
+		Timeouts: &schema.ResourceTimeout{
+			Update: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		CustomizeDiff: customdiff.All(
+			forceNewIfMemoryLimitToggled("runtime.0.agents_memory"),
+			customdiff.ForceNewIf("image", func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) bool {
+				return d.HasChange("image") && (d.Get("upgrade_strategy").(string) != upgradeStrategyRolling || d.Get("servers").(int) < minRollingUpgradeServers)
+			}),
+			customdiff.ComputedIf("credentials", func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) bool {
+				return d.HasChanges("kubeconfig.0.context_name", "kubeconfig.0.server_host")
+			}),
+			validateClusterFiles,
+			validateNodeFilterIndices,
+			checkNewHostPorts(true, func(d *schema.ResourceDiff, node *types.Node) bool {
+				name := d.Get("name").(string)
+				return node.RuntimeLabels[types.LabelClusterName] == name && strings.HasPrefix(node.Name, fmt.Sprintf("%s-%s-", types.DefaultObjectNamePrefix, name))
+			}),
+		),
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Description: "Cluster name.",
@@ -103,17 +123,130 @@ func resourceCluster() *schema.Resource {
 							ForceNew: true,
 							Optional: true,
 							Type:     schema.TypeList,
+							Elem: &schema.Schema{
+								Type:             schema.TypeString,
+								ValidateDiagFunc: validateNodeFilter(),
+							},
+						},
+					},
+				},
+			},
+			"file": {
+				Description: "Write files into the nodes, e.g. containerd config templates or CA bundles.",
+				ForceNew:    true,
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"content": {
+							Description: "File content. Exactly one of `content` or `source` must be set.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"source": {
+							Description: "Path to a local file to copy. Exactly one of `content` or `source` must be set.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"destination": {
+							Description: "Absolute path of the file in the nodes, or a path starting with one of the k3d shortcuts (e.g. `k3s-manifests/foo.yaml`).",
+							ForceNew:    true,
+							Required:    true,
+							Type:        schema.TypeString,
+						},
+						"description": {
+							Description: "Description of the file, shown in the logs.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"node_filters": {
+							ForceNew: true,
+							Optional: true,
+							Type:     schema.TypeList,
+							Elem: &schema.Schema{
+								Type:             schema.TypeString,
+								ValidateDiagFunc: validateNodeFilter(),
+							},
+						},
+					},
+				},
+			},
+			"helm_chart": {
+				Description: "Deploy a helm chart on startup through the k3s helm controller.",
+				ForceNew:    true,
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Name of the HelmChart resource, also used as release name.",
+							ForceNew:    true,
+							Required:    true,
+							Type:        schema.TypeString,
+						},
+						"chart": {
+							Description: "Chart name in the repository, or URL of the chart archive.",
+							ForceNew:    true,
+							Required:    true,
+							Type:        schema.TypeString,
+						},
+						"repo": {
+							Description: "Helm repository URL.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"target_namespace": {
+							Description: "Namespace to install the release into.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"values": {
+							Description: "Chart values, in YAML.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"version": {
+							Description: "Chart version.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+					},
+				},
+			},
+			"host_alias": {
+				Description: "Add entries to the `/etc/hosts` of the nodes and to the CoreDNS NodeHosts.",
+				ForceNew:    true,
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ip": {
+							ForceNew:     true,
+							Required:     true,
+							Type:         schema.TypeString,
+							ValidateFunc: validation.IsIPAddress,
+						},
+						"hostnames": {
+							ForceNew: true,
+							Required: true,
+							Type:     schema.TypeList,
 							Elem:     &schema.Schema{Type: schema.TypeString},
 						},
 					},
 				},
 			},
 			"image": {
-				Description: "Specify k3s image that you want to use for the nodes.",
-				ForceNew:    true,
+				Description: "Specify k3s image that you want to use for the nodes. Defaults to the latest stable k3s release at creation.",
 				Optional:    true,
+				Computed:    true,
 				Type:        schema.TypeString,
-				Default:     fmt.Sprintf("%s:%s", types.DefaultK3sImageRepo, k3sVersion),
 			},
 			"k3d": {
 				Description: "k3d runtime settings.",
@@ -135,6 +268,78 @@ func resourceCluster() *schema.Resource {
 							Optional:    true,
 							Type:        schema.TypeBool,
 						},
+						"load_balancer": {
+							Description: "Settings of the LoadBalancer in front of the server nodes.",
+							ForceNew:    true,
+							Optional:    true,
+							Type:        schema.TypeList,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"config_overrides": {
+										Description: "Override the LoadBalancer config, as `key=value` (e.g. `settings.workerConnections=2048`).",
+										ForceNew:    true,
+										Optional:    true,
+										Type:        schema.TypeList,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+									},
+									"default_proxy_timeout": {
+										Description:  "Default proxy timeout of nginx, in seconds.",
+										ForceNew:     true,
+										Optional:     true,
+										Type:         schema.TypeInt,
+										ValidateFunc: validation.IntAtLeast(1),
+									},
+									"labels": {
+										Description: "Runtime labels added to the LoadBalancer container.",
+										ForceNew:    true,
+										Optional:    true,
+										Type:        schema.TypeMap,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+									},
+									"port": {
+										Description: "Map ports from the LoadBalancer to the host.",
+										ForceNew:    true,
+										Optional:    true,
+										Type:        schema.TypeList,
+										Elem: &schema.Resource{
+											Schema: map[string]*schema.Schema{
+												"host": {
+													ForceNew: true,
+													Optional: true,
+													Type:     schema.TypeString,
+												},
+												"host_port": {
+													ForceNew:     true,
+													Optional:     true,
+													Type:         schema.TypeInt,
+													ValidateFunc: validation.IsPortNumber,
+												},
+												"container_port": {
+													ForceNew:     true,
+													Required:     true,
+													Type:         schema.TypeInt,
+													ValidateFunc: validation.IsPortNumber,
+												},
+												"protocol": {
+													ForceNew:     true,
+													Optional:     true,
+													Type:         schema.TypeString,
+													ValidateFunc: validation.StringInSlice([]string{"TCP", "UDP"}, true),
+												},
+											},
+										},
+									},
+									"worker_connections": {
+										Description:  "Number of nginx worker connections.",
+										ForceNew:     true,
+										Optional:     true,
+										Type:         schema.TypeInt,
+										ValidateFunc: validation.IntAtLeast(1),
+									},
+								},
+							},
+						},
 					},
 				},
 			},
@@ -162,7 +367,10 @@ func resourceCluster() *schema.Resource {
 										ForceNew: true,
 										Optional: true,
 										Type:     schema.TypeList,
-										Elem:     &schema.Schema{Type: schema.TypeString},
+										Elem: &schema.Schema{
+											Type:             schema.TypeString,
+											ValidateDiagFunc: validateNodeFilter(),
+										},
 									},
 								},
 							},
@@ -170,6 +378,11 @@ func resourceCluster() *schema.Resource {
 					},
 				},
 			},
+			"keep_on_failure": {
+				Description: "Keep the containers, networks and volumes of the cluster when its creation fails, for debugging, instead of rolling it back. The resource is then tainted and replaced on the next apply.",
+				Optional:    true,
+				Type:        schema.TypeBool,
+			},
 			"kube_api": {
 				ForceNew: true,
 				Optional: true,
@@ -202,7 +415,6 @@ func resourceCluster() *schema.Resource {
 			},
 			"kubeconfig": {
 				Description: "Manage the default kubeconfig",
-				ForceNew:    true,
 				Optional:    true,
 				Type:        schema.TypeList,
 				MaxItems:    1,
@@ -222,6 +434,16 @@ func resourceCluster() *schema.Resource {
 							Type:        schema.TypeBool,
 							Default:     false,
 						},
+						"context_name": {
+							Description: "Name of the cluster's context, instead of `k3d-<name>`. Changing it rewrites the credentials and the default kubeconfig, if updated.",
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
+						"server_host": {
+							Description: "Host of the API server in the kubeconfig, e.g. `host.docker.internal` to reach the cluster from other containers. Changing it rewrites the credentials and the default kubeconfig, if updated.",
+							Optional:    true,
+							Type:        schema.TypeString,
+						},
 					},
 				},
 			},
@@ -246,7 +468,42 @@ func resourceCluster() *schema.Resource {
 							ForceNew: true,
 							Optional: true,
 							Type:     schema.TypeList,
-							Elem:     &schema.Schema{Type: schema.TypeString},
+							Elem: &schema.Schema{
+								Type:             schema.TypeString,
+								ValidateDiagFunc: validateNodeFilter(),
+							},
+						},
+					},
+				},
+			},
+			"load_balancer_ip": {
+				Description: "IP of the LoadBalancer in the cluster network.",
+				Computed:    true,
+				Type:        schema.TypeString,
+			},
+			"load_balancer_name": {
+				Description: "Container name of the LoadBalancer.",
+				Computed:    true,
+				Type:        schema.TypeString,
+			},
+			"manifest": {
+				Description: "Apply a Kubernetes manifest on startup through the k3s auto-deploying manifests.",
+				ForceNew:    true,
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Manifest file name, without the `.yaml` extension.",
+							ForceNew:    true,
+							Required:    true,
+							Type:        schema.TypeString,
+						},
+						"content": {
+							Description: "Manifest content, in YAML.",
+							ForceNew:    true,
+							Required:    true,
+							Type:        schema.TypeString,
 						},
 					},
 				},
@@ -292,7 +549,10 @@ func resourceCluster() *schema.Resource {
 							ForceNew: true,
 							Optional: true,
 							Type:     schema.TypeList,
-							Elem:     &schema.Schema{Type: schema.TypeString},
+							Elem: &schema.Schema{
+								Type:             schema.TypeString,
+								ValidateDiagFunc: validateNodeFilter(portNodeFilterSuffixes...),
+							},
 						},
 					},
 				},
@@ -356,17 +616,21 @@ func resourceCluster() *schema.Resource {
 					},
 				},
 			},
+			"restore_from_snapshot": {
+				Description: "Path on the host of an etcd snapshot, e.g. from `k3d_etcd_snapshot`, to restore the new cluster from. The first server is created with `--cluster-reset` and `--cluster-reset-restore-path` to restore it before the other nodes start and join it. Needs the embedded etcd, i.e. more than one server, and the `token` of the cluster the snapshot was taken from.",
+				ForceNew:    true,
+				Optional:    true,
+				Type:        schema.TypeString,
+			},
 			"runtime": {
 				Description: "Runtime (Docker) specific options",
-				ForceNew:    true,
 				Optional:    true,
 				Type:        schema.TypeList,
 				MaxItems:    1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"agents_memory": {
-							Description: "Memory limit imposed on the agents nodes [From docker].",
-							ForceNew:    true,
+							Description: "Memory limit imposed on the agents nodes [From docker]. Changing the limit restarts the agents and leaves them no swap on top of it, setting or removing it replaces the cluster.",
 							Optional:    true,
 							Type:        schema.TypeString,
 						},
@@ -392,6 +656,13 @@ func resourceCluster() *schema.Resource {
 				Type:        schema.TypeInt,
 				Default:     1,
 			},
+			"upgrade_strategy": {
+				Description:  fmt.Sprintf("How to roll out a change of `image`: `%s` the cluster, or replace its nodes one at a time in a `%s` upgrade, servers first. Each node is drained and has to be Ready before moving on to the next one, both within the update timeout, or is brought back on its previous container. Rolling upgrades need at least %d servers to keep etcd quorum, smaller clusters are recreated.", upgradeStrategyRecreate, upgradeStrategyRolling, minRollingUpgradeServers),
+				Optional:     true,
+				Type:         schema.TypeString,
+				Default:      upgradeStrategyRecreate,
+				ValidateFunc: validation.StringInSlice([]string{upgradeStrategyRecreate, upgradeStrategyRolling}, false),
+			},
 			/*
 				"subnet": {
 					Description:  "[Experimental: IPAM] Define a subnet for the newly created container network.",
@@ -402,9 +673,8 @@ func resourceCluster() *schema.Resource {
 				},
 			*/
 			"token": {
-				Description: "Specify a cluster token. By default, we generate one.",
+				Description: "Specify a cluster token. By default, we generate one. Changing it rotates the token of the running cluster with `k3s token rotate`.",
 				Computed:    true,
-				ForceNew:    true,
 				Optional:    true,
 				Sensitive:   true,
 				Type:        schema.TypeString,
@@ -430,7 +700,10 @@ func resourceCluster() *schema.Resource {
 							ForceNew: true,
 							Optional: true,
 							Type:     schema.TypeList,
-							Elem:     &schema.Schema{Type: schema.TypeString},
+							Elem: &schema.Schema{
+								Type:             schema.TypeString,
+								ValidateDiagFunc: validateNodeFilter(),
+							},
 						},
 					},
 				},
@@ -439,9 +712,37 @@ func resourceCluster() *schema.Resource {
 	}
 }
 
-func getSimpleConfig(d *schema.ResourceData) *v1alpha5.SimpleConfig {
+// validateClusterFiles checks that each file has either a content or a source.
+func validateClusterFiles(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	for i, f := range d.Get("file").([]interface{}) {
+		if f == nil {
+			continue
+		}
+
+		// content may not be known before apply
+		content := fmt.Sprintf("file.%d.content", i)
+		source := fmt.Sprintf("file.%d.source", i)
+		if !d.NewValueKnown(content) || !d.NewValueKnown(source) {
+			continue
+		}
+
+		v := f.(map[string]interface{})
+		if (v["content"].(string) == "") == (v["source"].(string) == "") {
+			return fmt.Errorf("file.%d: exactly one of content or source must be set", i)
+		}
+	}
+
+	return nil
+}
+
+func getSimpleConfig(d *schema.ResourceData) (*v1alpha5.SimpleConfig, error) {
 	clusterName := d.Get("name").(string)
 
+	manifests, err := expandManifests(d.Get("manifest").([]interface{}), d.Get("helm_chart").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
 	// TODO: validate all values with GetOk
 	simpleConfig := &v1alpha5.SimpleConfig{
 		ObjectMeta: types2.ObjectMeta{
@@ -451,17 +752,14 @@ func getSimpleConfig(d *schema.ResourceData) *v1alpha5.SimpleConfig {
 		ClusterToken: d.Get("token").(string),
 		Env:          expandEnvVars(d.Get("env").([]interface{})),
 		ExposeAPI:    expandExposureOptions(d.Get("kube_api").([]interface{})),
+		Files:        append(expandFiles(d.Get("file").([]interface{})), manifests...),
+		HostAliases:  expandHostAliases(d.Get("host_alias").([]interface{})),
 		Image:        d.Get("image").(string),
 		Network:      d.Get("network").(string),
-		Ports:        expandPorts(d.Get("port").([]interface{})),
+		Ports:        append(expandPorts(d.Get("port").([]interface{})), expandLoadBalancerPorts(d.Get("k3d.0.load_balancer").([]interface{}))...),
 		Servers:      d.Get("servers").(int),
 		//Subnet:       d.Get("subnet").(string),
 		Volumes: expandVolumes(d.Get("volume").([]interface{})),
-		Options: v1alpha5.SimpleConfigOptions{
-			Runtime: v1alpha5.SimpleConfigOptionsRuntime{
-				Labels: expandLabels(d.Get("label").([]interface{})),
-			},
-		},
 	}
 
 	simpleConfig.Options = v1alpha5.SimpleConfigOptions{
@@ -470,6 +768,7 @@ func getSimpleConfig(d *schema.ResourceData) *v1alpha5.SimpleConfig {
 		KubeconfigOptions: expandConfigOptionsKubeconfig(d.Get("kubeconfig").([]interface{})),
 		Runtime:           expandConfigOptionsRuntime(d.Get("runtime").([]interface{})),
 	}
+	simpleConfig.Options.Runtime.Labels = append(expandLabels(d.Get("label").([]interface{})), expandLoadBalancerLabels(d.Get("k3d.0.load_balancer").([]interface{}))...)
 
 	l := d.Get("registries").([]interface{})
 	if len(l) != 0 && l[0] != nil {
@@ -493,12 +792,12 @@ func getSimpleConfig(d *schema.ResourceData) *v1alpha5.SimpleConfig {
 		simpleConfig.Registries.Use = use
 	}
 
-	return simpleConfig
+	return simpleConfig, nil
 }
 
-func getClusterConfig(ctx context.Context, simpleConfig v1alpha5.SimpleConfig) (*v1alpha5.ClusterConfig, error) {
+func getClusterConfig(ctx context.Context, runtime runtimes.Runtime, simpleConfig v1alpha5.SimpleConfig) (*v1alpha5.ClusterConfig, error) {
 	// transform simple config to cluster config
-	clusterConfig, err := config.TransformSimpleToClusterConfig(ctx, runtimes.SelectedRuntime, simpleConfig)
+	clusterConfig, err := config.TransformSimpleToClusterConfig(ctx, runtime, simpleConfig, "")
 	if err != nil {
 		return nil, err
 	}
@@ -510,7 +809,7 @@ func getClusterConfig(ctx context.Context, simpleConfig v1alpha5.SimpleConfig) (
 	}
 
 	// validate cluster config
-	if err = config.ValidateClusterConfig(ctx, runtimes.SelectedRuntime, *clusterConfig); err != nil {
+	if err = config.ValidateClusterConfig(ctx, runtime, *clusterConfig); err != nil {
 		return nil, err
 	}
 
@@ -519,31 +818,53 @@ func getClusterConfig(ctx context.Context, simpleConfig v1alpha5.SimpleConfig) (
 
 func resourceClusterCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	clusterName := d.Get("name").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if err := setDefaultK3sImage(d); err != nil {
+		return diag.FromErr(err)
+	}
 
-	simpleConfig := getSimpleConfig(d)
+	simpleConfig, err := getSimpleConfig(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	clusterConfig, err := getClusterConfig(ctx, *simpleConfig)
+	clusterConfig, err := getClusterConfig(ctx, runtime, *simpleConfig)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
 	// check if a cluster with that name exists already
-	if _, err = client.ClusterGet(ctx, runtimes.SelectedRuntime, &clusterConfig.Cluster); err == nil {
+	if _, err = client.ClusterGet(ctx, runtime, &clusterConfig.Cluster); err == nil {
 		return diag.Errorf("Failed to create cluster because a cluster with that name already exists")
 	}
 
+	// k3d fails halfway through when a host port is taken, check them first
+	if err := checkHostPorts(ctx, runtime, clusterHostPorts(&clusterConfig.Cluster)); err != nil {
+		return diag.Errorf("Failed to create cluster: %s", err)
+	}
+
 	// create cluster
-	if err = client.ClusterRun(ctx, runtimes.SelectedRuntime, clusterConfig); err != nil {
-		// rollback if creation failed
-		if deleteErr := client.ClusterDelete(ctx, runtimes.SelectedRuntime, &types.Cluster{Name: clusterName}, types.ClusterDeleteOpts{SkipRegistryCheck: false}); deleteErr != nil {
-			return diag.Errorf("Cluster creation FAILED, also FAILED to rollback changes!")
+	if snapshot, ok := d.GetOk("restore_from_snapshot"); ok {
+		err = runClusterFromEtcdSnapshot(ctx, runtime, clusterConfig, snapshot.(string))
+	} else {
+		err = client.ClusterRun(ctx, runtime, clusterConfig)
+	}
+	if err != nil {
+		keep := d.Get("keep_on_failure").(bool)
+		if keep {
+			// the cluster exists, have it tainted rather than leaked
+			d.SetId(clusterName)
 		}
-		return diag.FromErr(err)
+		return rollbackClusterCreate(ctx, meta.(*apiClient), &clusterConfig.Cluster, err, keep)
 	}
 
 	// update default kubeconfig
 	if clusterConfig.KubeconfigOpts.UpdateDefaultKubeconfig {
-		if _, err := client.KubeconfigGetWrite(ctx, runtimes.SelectedRuntime, &clusterConfig.Cluster, "", &client.WriteKubeConfigOptions{UpdateExisting: true, OverwriteExisting: false, UpdateCurrentContext: simpleConfig.Options.KubeconfigOptions.SwitchCurrentContext}); err != nil {
+		if err := updateDefaultKubeconfig(ctx, runtime, d, &clusterConfig.Cluster); err != nil {
 			log.Printf("[WARN] %s", err)
 		}
 	}
@@ -553,55 +874,221 @@ func resourceClusterCreate(ctx context.Context, d *schema.ResourceData, meta int
 	return resourceClusterRead(ctx, d, meta)
 }
 
+// rollbackClusterCreate deletes what is left of cluster after its creation
+// failed with err, unless keep, and returns the diagnostics of the failure.
+func rollbackClusterCreate(ctx context.Context, c *apiClient, cluster *types.Cluster, err error, keep bool) diag.Diagnostics {
+	runtime := c.runtime
+	diags := diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  "Failed to create cluster",
+		Detail:   err.Error(),
+	}}
+
+	// the logs are gone along with the nodes
+	diags = append(diags, nodeLogsDiagnostics(ctx, c, failedNodes(ctx, runtime, map[string]string{types.LabelClusterName: cluster.Name}, err))...)
+
+	if keep {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Cluster kept for debugging",
+			Detail:   fmt.Sprintf("keep_on_failure is set, the cluster is not rolled back and will be replaced on the next apply.\n\n%s", clusterLeftovers(ctx, runtime, cluster)),
+		})
+	}
+
+	if deleteErr := client.ClusterDelete(ctx, runtime, &types.Cluster{Name: cluster.Name}, types.ClusterDeleteOpts{SkipRegistryCheck: false}); deleteErr != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  "Failed to roll back cluster creation",
+			Detail:   fmt.Sprintf("%s\n\n%s", deleteErr, clusterLeftovers(ctx, runtime, cluster)),
+		})
+	}
+
+	return diags
+}
+
+// clusterLeftovers describes the containers, network and volumes of cluster
+// still in the runtime, to be deleted by hand.
+func clusterLeftovers(ctx context.Context, runtime runtimes.Runtime, cluster *types.Cluster) string {
+	labels := map[string]string{types.LabelClusterName: cluster.Name}
+	var leftovers []string
+
+	nodes, err := runtime.GetNodesByLabel(ctx, labels)
+	if err != nil {
+		leftovers = append(leftovers, fmt.Sprintf("- containers: failed to list them: %s", err))
+	} else if len(nodes) > 0 {
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		sort.Strings(names)
+		leftovers = append(leftovers, fmt.Sprintf("- containers: %s", strings.Join(names, ", ")))
+	}
+
+	// networks joined by the cluster aren't its own
+	if cluster.Network.Name != "" && !cluster.Network.External {
+		if _, err := runtime.GetNetwork(ctx, &types.ClusterNetwork{Name: cluster.Network.Name}); err == nil {
+			leftovers = append(leftovers, fmt.Sprintf("- network: %s", cluster.Network.Name))
+		}
+	}
+
+	volumes, err := runtime.GetVolumesByLabel(ctx, labels)
+	if err != nil {
+		leftovers = append(leftovers, fmt.Sprintf("- volumes: failed to list them: %s", err))
+	} else if len(volumes) > 0 {
+		sort.Strings(volumes)
+		leftovers = append(leftovers, fmt.Sprintf("- volumes: %s", strings.Join(volumes, ", ")))
+	}
+
+	if len(leftovers) == 0 {
+		return "Nothing was left behind."
+	}
+	return "Left behind:\n" + strings.Join(leftovers, "\n")
+}
+
 func resourceClusterRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	clusterName := d.Get("name").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 
-	cluster, err := client.ClusterGet(ctx, runtimes.SelectedRuntime, &types.Cluster{Name: clusterName})
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	if err := d.Set("network", cluster.Network.Name); err != nil {
 		return diag.FromErr(err)
 	}
-	if err := d.Set("token", cluster.Token); err != nil {
+	token, err := getClusterToken(ctx, runtime, cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("token", token); err != nil {
 		return diag.FromErr(err)
 	}
 
-	k, err := client.KubeconfigGet(ctx, runtimes.SelectedRuntime, cluster)
+	loadBalancerName, loadBalancerIP := "", ""
+	if cluster.ServerLoadBalancer != nil && cluster.ServerLoadBalancer.Node != nil {
+		loadBalancerName = cluster.ServerLoadBalancer.Node.Name
+		if cluster.ServerLoadBalancer.Node.IP.IP.IsValid() {
+			loadBalancerIP = cluster.ServerLoadBalancer.Node.IP.IP.String()
+		}
+	}
+	if err := d.Set("load_balancer_name", loadBalancerName); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("load_balancer_ip", loadBalancerIP); err != nil {
+		return diag.FromErr(err)
+	}
+
+	k, err := client.KubeconfigGet(ctx, runtime, cluster)
+	if err == nil {
+		err = customizeKubeconfig(k, d.Get("kubeconfig.0.context_name").(string), d.Get("kubeconfig.0.server_host").(string))
+	}
 	if err == nil {
-		if err == nil {
-			if err := d.Set("credentials", flattenCredentials(clusterName, k)); err != nil {
+		var credentials []interface{}
+		if credentials, err = flattenCredentials(k); err == nil {
+			if err := d.Set("credentials", credentials); err != nil {
 				return diag.FromErr(err)
 			}
-		} else {
-			log.Printf("[WARN] %s", err)
 		}
-	} else {
+	}
+	if err != nil {
 		log.Printf("[WARN] %s", err)
 	}
 
 	return nil
 }
 
-/*
 func resourceClusterUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	// use the meta value to retrieve your client from the provider configure method
-	// client := meta.(*apiClient)
+	clusterName := d.Get("name").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if d.HasChange("runtime.0.agents_memory") {
+		cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		// only the agents created along with the cluster, not the ones added
+		// later on through k3d_node
+		agents := make(map[string]bool, d.Get("agents").(int))
+		for i := 0; i < d.Get("agents").(int); i++ {
+			agents[client.GenerateNodeName(clusterName, types.AgentRole, i)] = true
+		}
+
+		for _, node := range cluster.Nodes {
+			if !agents[node.Name] {
+				continue
+			}
+
+			if err := updateNodeMemory(ctx, runtime, node, d.Get("runtime.0.agents_memory").(string)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("token") {
+		oldToken, newToken := d.GetChange("token")
+		if err := rotateClusterToken(ctx, runtime, clusterName, oldToken.(string), newToken.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChanges("kubeconfig.0.context_name", "kubeconfig.0.server_host") && d.Get("kubeconfig.0.update_default_kubeconfig").(bool) {
+		cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		oldContextName, newContextName := d.GetChange("kubeconfig.0.context_name")
+		if err := renameDefaultKubeconfigContext(ctx, kubeconfigContextName(clusterName, oldContextName.(string)), kubeconfigContextName(clusterName, newContextName.(string))); err != nil {
+			return diag.FromErr(err)
+		}
+		if err := updateDefaultKubeconfig(ctx, runtime, d, cluster); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-	return diag.Errorf("not implemented")
+	if d.HasChange("image") {
+		memory := map[types.Role]string{
+			types.ServerRole: d.Get("runtime.0.servers_memory").(string),
+			types.AgentRole:  d.Get("runtime.0.agents_memory").(string),
+		}
+
+		simpleConfig, err := getSimpleConfig(d)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := rollingUpgradeCluster(ctx, runtime, clusterName, d.Get("servers").(int), d.Get("agents").(int), d.Get("image").(string), memory, simpleConfig.Files, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceClusterRead(ctx, d, meta)
 }
-*/
 
 func resourceClusterDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	clusterName := d.Get("name").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 
-	if err := client.ClusterDelete(ctx, runtimes.SelectedRuntime, &types.Cluster{Name: clusterName}, types.ClusterDeleteOpts{SkipRegistryCheck: false}); err != nil {
+	if err := client.ClusterDelete(ctx, runtime, &types.Cluster{Name: clusterName}, types.ClusterDeleteOpts{SkipRegistryCheck: false}); err != nil {
 		return diag.FromErr(err)
 	}
 
-	simpleConfig := getSimpleConfig(d)
+	simpleConfig, err := getSimpleConfig(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	clusterConfig, err := getClusterConfig(ctx, *simpleConfig)
+	clusterConfig, err := getClusterConfig(ctx, runtime, *simpleConfig)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -611,6 +1098,12 @@ func resourceClusterDelete(ctx context.Context, d *schema.ResourceData, meta int
 		log.Printf("[WARN] Failed to remove cluster details from default kubeconfig")
 		log.Printf("[WARN] %s", err)
 	}
+	if contextName := d.Get("kubeconfig.0.context_name").(string); contextName != "" {
+		if err := removeDefaultKubeconfigContext(ctx, contextName); err != nil {
+			log.Printf("[WARN] Failed to remove context %s from default kubeconfig", contextName)
+			log.Printf("[WARN] %s", err)
+		}
+	}
 
 	return nil
 }
@@ -629,10 +1122,82 @@ func expandConfigOptionsK3d(l []interface{}) v1alpha5.SimpleConfigOptionsK3d {
 	in := l[0].(map[string]interface{})
 	opts.DisableImageVolume = in["disable_image_volume"].(bool)
 	opts.DisableLoadbalancer = in["disable_load_balancer"].(bool)
+	opts.Loadbalancer.ConfigOverrides = expandLoadBalancerConfigOverrides(in["load_balancer"].([]interface{}))
 
 	return opts
 }
 
+func expandLoadBalancerConfigOverrides(l []interface{}) []string {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	v := l[0].(map[string]interface{})
+
+	overrides := make([]string, 0)
+	if workerConnections := v["worker_connections"].(int); workerConnections != 0 {
+		overrides = append(overrides, fmt.Sprintf("settings.workerConnections=%d", workerConnections))
+	}
+	if defaultProxyTimeout := v["default_proxy_timeout"].(int); defaultProxyTimeout != 0 {
+		overrides = append(overrides, fmt.Sprintf("settings.defaultProxyTimeout=%d", defaultProxyTimeout))
+	}
+	for _, i := range v["config_overrides"].([]interface{}) {
+		overrides = append(overrides, i.(string))
+	}
+
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	return overrides
+}
+
+func expandLoadBalancerLabels(l []interface{}) []v1alpha5.LabelWithNodeFilters {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	v := l[0].(map[string]interface{})
+
+	labels := expandStringMap(v["labels"].(map[string]interface{}))
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lbLabels := make([]v1alpha5.LabelWithNodeFilters, 0, len(keys))
+	for _, key := range keys {
+		lbLabels = append(lbLabels, v1alpha5.LabelWithNodeFilters{
+			Label:       fmt.Sprintf("%s=%s", key, labels[key]),
+			NodeFilters: []string{"loadbalancer"},
+		})
+	}
+
+	return lbLabels
+}
+
+func expandLoadBalancerPorts(l []interface{}) []v1alpha5.PortWithNodeFilters {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	v := l[0].(map[string]interface{})
+
+	ports := make([]interface{}, 0, len(v["port"].([]interface{})))
+	for _, i := range v["port"].([]interface{}) {
+		port := map[string]interface{}{
+			"node_filters": []interface{}{"loadbalancer"},
+		}
+		for key, value := range i.(map[string]interface{}) {
+			port[key] = value
+		}
+		ports = append(ports, port)
+	}
+
+	return expandPorts(ports)
+}
+
 func expandConfigOptionsK3s(l []interface{}) v1alpha5.SimpleConfigOptionsK3s {
 	if len(l) == 0 || l[0] == nil {
 		return v1alpha5.SimpleConfigOptionsK3s{}
@@ -719,6 +1284,121 @@ func expandExposureOptions(l []interface{}) v1alpha5.SimpleExposureOpts {
 	}
 }
 
+func expandFiles(l []interface{}) []v1alpha5.FileWithNodeFilters {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	files := make([]v1alpha5.FileWithNodeFilters, 0, len(l))
+	for _, i := range l {
+		v := i.(map[string]interface{})
+
+		// k3d takes the source as a path, unless it spans multiple lines
+		source := v["source"].(string)
+		if content := v["content"].(string); content != "" {
+			source = withTrailingNewline(content)
+		}
+
+		files = append(files, v1alpha5.FileWithNodeFilters{
+			Source:      source,
+			Destination: v["destination"].(string),
+			Description: v["description"].(string),
+			NodeFilters: expandNodeFilters(v["node_filters"].([]interface{})),
+		})
+	}
+
+	return files
+}
+
+// expandManifests turns manifests and helm charts into files written to the
+// k3s auto-deploying manifests directory of the servers.
+func expandManifests(manifests []interface{}, helmCharts []interface{}) ([]v1alpha5.FileWithNodeFilters, error) {
+	files := make([]v1alpha5.FileWithNodeFilters, 0, len(manifests)+len(helmCharts))
+	for _, i := range manifests {
+		v := i.(map[string]interface{})
+		files = append(files, newManifestFile(v["name"].(string), v["content"].(string)))
+	}
+
+	for _, i := range helmCharts {
+		v := i.(map[string]interface{})
+
+		spec := map[string]interface{}{
+			"chart": v["chart"].(string),
+		}
+		if repo := v["repo"].(string); repo != "" {
+			spec["repo"] = repo
+		}
+		if targetNamespace := v["target_namespace"].(string); targetNamespace != "" {
+			spec["targetNamespace"] = targetNamespace
+		}
+		if values := v["values"].(string); values != "" {
+			spec["valuesContent"] = values
+		}
+		if version := v["version"].(string); version != "" {
+			spec["version"] = version
+		}
+
+		content, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": "helm.cattle.io/v1",
+			"kind":       "HelmChart",
+			"metadata": map[string]interface{}{
+				"name":      v["name"].(string),
+				"namespace": "kube-system",
+			},
+			"spec": spec,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render helm chart '%s': %w", v["name"].(string), err)
+		}
+
+		files = append(files, newManifestFile("helm-chart-"+v["name"].(string), string(content)))
+	}
+
+	return files, nil
+}
+
+func newManifestFile(name string, content string) v1alpha5.FileWithNodeFilters {
+	return v1alpha5.FileWithNodeFilters{
+		Source:      withTrailingNewline(content),
+		Destination: fmt.Sprintf("%s/%s.yaml", k3s.K3sPathManifests, name),
+		Description: fmt.Sprintf("Write manifest %s", name),
+		NodeFilters: []string{"server:*"},
+	}
+}
+
+// withTrailingNewline makes sure k3d takes a file content as is: it reads
+// single line sources as file paths.
+func withTrailingNewline(content string) string {
+	if strings.HasSuffix(content, "\n") {
+		return content
+	}
+
+	return content + "\n"
+}
+
+func expandHostAliases(l []interface{}) []types.HostAlias {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	hostAliases := make([]types.HostAlias, 0, len(l))
+	for _, i := range l {
+		v := i.(map[string]interface{})
+
+		hostnames := make([]string, 0, len(v["hostnames"].([]interface{})))
+		for _, hostname := range v["hostnames"].([]interface{}) {
+			hostnames = append(hostnames, hostname.(string))
+		}
+
+		hostAliases = append(hostAliases, types.HostAlias{
+			IP:        v["ip"].(string),
+			Hostnames: hostnames,
+		})
+	}
+
+	return hostAliases
+}
+
 func expandLabels(l []interface{}) []v1alpha5.LabelWithNodeFilters {
 	if len(l) == 0 || l[0] == nil {
 		return nil
@@ -758,7 +1438,7 @@ func expandPorts(l []interface{}) []v1alpha5.PortWithNodeFilters {
 	for _, i := range l {
 		v := i.(map[string]interface{})
 		ports = append(ports, v1alpha5.PortWithNodeFilters{
-			Port:        fmt.Sprintf("%s:%d:%d/%s", v["host"].(string), v["host_port"].(int), v["container_port"].(int), v["protocol"].(string)),
+			Port:        expandPort(v["host"].(string), v["host_port"].(int), v["container_port"].(int), v["protocol"].(string)),
 			NodeFilters: expandNodeFilters(v["node_filters"].([]interface{})),
 		})
 	}
@@ -766,6 +1446,27 @@ func expandPorts(l []interface{}) []v1alpha5.PortWithNodeFilters {
 	return ports
 }
 
+// expandPort builds a docker port mapping, [HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL],
+// leaving out the empty parts.
+func expandPort(host string, hostPort int, containerPort int, protocol string) string {
+	port := fmt.Sprintf("%d", containerPort)
+	if hostPort != 0 {
+		port = fmt.Sprintf("%d:%s", hostPort, port)
+	}
+	if host != "" {
+		if hostPort == 0 {
+			// the empty host port tells the host apart from a host port
+			port = ":" + port
+		}
+		port = fmt.Sprintf("%s:%s", host, port)
+	}
+	if protocol != "" {
+		port = fmt.Sprintf("%s/%s", port, protocol)
+	}
+
+	return port
+}
+
 func expandVolumes(l []interface{}) []v1alpha5.VolumeWithNodeFilters {
 	if len(l) == 0 || l[0] == nil {
 		return nil
@@ -789,19 +1490,35 @@ func expandVolumes(l []interface{}) []v1alpha5.VolumeWithNodeFilters {
 	return volumes
 }
 
-func flattenCredentials(clusterName string, config *clientcmdapi.Config) []interface{} {
-	clusterID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, clusterName)
-	authInfoName := fmt.Sprintf("admin@%s-%s", types.DefaultObjectNamePrefix, clusterName)
+// flattenCredentials reads the credentials of the current context.
+func flattenCredentials(config *clientcmdapi.Config) ([]interface{}, error) {
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok || context == nil {
+		return nil, fmt.Errorf("kubeconfig has no current context '%s'", config.CurrentContext)
+	}
+
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok || cluster == nil {
+		return nil, fmt.Errorf("kubeconfig has no cluster '%s'", context.Cluster)
+	}
 
-	raw, _ := clientcmd.Write(*config)
+	authInfo, ok := config.AuthInfos[context.AuthInfo]
+	if !ok || authInfo == nil {
+		return nil, fmt.Errorf("kubeconfig has no user '%s'", context.AuthInfo)
+	}
+
+	raw, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, err
+	}
 
 	creds := map[string]interface{}{
-		"client_certificate":     string(config.AuthInfos[authInfoName].ClientCertificateData),
-		"client_key":             string(config.AuthInfos[authInfoName].ClientKeyData),
-		"cluster_ca_certificate": string(config.Clusters[clusterID].CertificateAuthorityData),
-		"host":                   config.Clusters[clusterID].Server,
+		"client_certificate":     string(authInfo.ClientCertificateData),
+		"client_key":             string(authInfo.ClientKeyData),
+		"cluster_ca_certificate": string(cluster.CertificateAuthorityData),
+		"host":                   cluster.Server,
 		"raw":                    string(raw),
 	}
 
-	return []interface{}{creds}
+	return []interface{}{creds}, nil
 }
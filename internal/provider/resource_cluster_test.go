@@ -1,32 +1,616 @@
 package provider
 
 import (
-	"regexp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"sigs.k8s.io/yaml"
 )
 
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+func init() {
+	resource.AddTestSweepers("k3d_cluster", &resource.Sweeper{
+		Name: "k3d_cluster",
+		F:    sweepClusters,
+	})
+}
+
+func sweepClusters(_ string) error {
+	ctx := context.Background()
+
+	clusters, err := client.ClusterList(ctx, runtimes.SelectedRuntime)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cluster := range clusters {
+		if !isSweepable(cluster.Name) {
+			continue
+		}
+
+		log.Printf("[INFO] Deleting cluster %s", cluster.Name)
+		if err := client.ClusterDelete(ctx, runtimes.SelectedRuntime, cluster, types.ClusterDeleteOpts{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func TestAccResourceCluster(t *testing.T) {
 	//t.Skip("resource not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccResourceCluster,
+				Config: testAccResourceCluster(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"k3d_cluster.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"k3d_cluster.foo", "name", name),
 				),
 			},
 		},
 	})
 }
 
-const testAccResourceCluster = `
+func testAccResourceCluster(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_cluster" "foo" {
-  name = "bar"
+  name = %[1]q
+}
+`, name)
+}
+
+func TestExpandManifests(t *testing.T) {
+	files, err := expandManifests(
+		[]interface{}{
+			map[string]interface{}{
+				"name":    "foo",
+				"content": "kind: Namespace",
+			},
+		},
+		[]interface{}{
+			map[string]interface{}{
+				"name":             "bar",
+				"chart":            "bar",
+				"repo":             "https://charts.example.com",
+				"target_namespace": "",
+				"values":           "replicas: 2\n",
+				"version":          "1.0.0",
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []v1alpha5.FileWithNodeFilters{
+		{
+			Source:      "kind: Namespace\n",
+			Destination: "/var/lib/rancher/k3s/server/manifests/foo.yaml",
+			Description: "Write manifest foo",
+			NodeFilters: []string{"server:*"},
+		},
+		{
+			Source: `apiVersion: helm.cattle.io/v1
+kind: HelmChart
+metadata:
+  name: bar
+  namespace: kube-system
+spec:
+  chart: bar
+  repo: https://charts.example.com
+  valuesContent: |
+    replicas: 2
+  version: 1.0.0
+`,
+			Destination: "/var/lib/rancher/k3s/server/manifests/helm-chart-bar.yaml",
+			Description: "Write manifest helm-chart-bar",
+			NodeFilters: []string{"server:*"},
+		},
+	}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %#v, got %#v", expected, files)
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	files := expandFiles([]interface{}{
+		map[string]interface{}{
+			"content":      "foo",
+			"source":       "",
+			"destination":  "/etc/foo",
+			"description":  "",
+			"node_filters": []interface{}{"agent:*"},
+		},
+		map[string]interface{}{
+			"content":      "",
+			"source":       "bar.tmpl",
+			"destination":  "k3s-containerd-tmpl",
+			"description":  "containerd config",
+			"node_filters": []interface{}{},
+		},
+	})
+
+	expected := []v1alpha5.FileWithNodeFilters{
+		{
+			Source:      "foo\n",
+			Destination: "/etc/foo",
+			NodeFilters: []string{"agent:*"},
+		},
+		{
+			Source:      "bar.tmpl",
+			Destination: "k3s-containerd-tmpl",
+			Description: "containerd config",
+		},
+	}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %#v, got %#v", expected, files)
+	}
+}
+
+func TestExpandHostAliases(t *testing.T) {
+	hostAliases := expandHostAliases([]interface{}{
+		map[string]interface{}{
+			"ip":        "10.0.0.1",
+			"hostnames": []interface{}{"foo.local", "bar.local"},
+		},
+	})
+
+	expected := []types.HostAlias{
+		{IP: "10.0.0.1", Hostnames: []string{"foo.local", "bar.local"}},
+	}
+
+	if !reflect.DeepEqual(hostAliases, expected) {
+		t.Errorf("expected %#v, got %#v", expected, hostAliases)
+	}
+}
+
+func TestExpandLoadBalancer(t *testing.T) {
+	lb := []interface{}{
+		map[string]interface{}{
+			"config_overrides":      []interface{}{"ports.8080.tcp=k3d-foo-agent-0"},
+			"default_proxy_timeout": 900,
+			"labels":                map[string]interface{}{"foo": "bar", "bar": "baz"},
+			"port":                  []interface{}{},
+			"worker_connections":    0,
+		},
+	}
+
+	overrides := expandLoadBalancerConfigOverrides(lb)
+	expectedOverrides := []string{"settings.defaultProxyTimeout=900", "ports.8080.tcp=k3d-foo-agent-0"}
+	if !reflect.DeepEqual(overrides, expectedOverrides) {
+		t.Errorf("expected %#v, got %#v", expectedOverrides, overrides)
+	}
+
+	labels := expandLoadBalancerLabels(lb)
+	expectedLabels := []v1alpha5.LabelWithNodeFilters{
+		{Label: "bar=baz", NodeFilters: []string{"loadbalancer"}},
+		{Label: "foo=bar", NodeFilters: []string{"loadbalancer"}},
+	}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("expected %#v, got %#v", expectedLabels, labels)
+	}
+
+	if overrides := expandLoadBalancerConfigOverrides(nil); overrides != nil {
+		t.Errorf("expected no overrides, got %#v", overrides)
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	cases := []struct {
+		name     string
+		port     map[string]interface{}
+		expected string
+	}{
+		{"container port", testPort("", 0, 80, ""), "80"},
+		{"host port", testPort("", 8080, 80, ""), "8080:80"},
+		{"host", testPort("0.0.0.0", 0, 80, ""), "0.0.0.0::80"},
+		{"host and host port", testPort("0.0.0.0", 8080, 80, ""), "0.0.0.0:8080:80"},
+		{"protocol", testPort("", 0, 53, "UDP"), "53/UDP"},
+		{"all", testPort("127.0.0.1", 5353, 53, "UDP"), "127.0.0.1:5353:53/UDP"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ports := expandPorts([]interface{}{c.port})
+			expected := []v1alpha5.PortWithNodeFilters{{Port: c.expected, NodeFilters: []string{"loadbalancer"}}}
+			if !reflect.DeepEqual(ports, expected) {
+				t.Errorf("expected %#v, got %#v", expected, ports)
+			}
+		})
+	}
+
+	if ports := expandPorts(nil); ports != nil {
+		t.Errorf("expected no ports, got %#v", ports)
+	}
+}
+
+func testPort(host string, hostPort int, containerPort int, protocol string) map[string]interface{} {
+	return map[string]interface{}{
+		"host":           host,
+		"host_port":      hostPort,
+		"container_port": containerPort,
+		"protocol":       protocol,
+		"node_filters":   []interface{}{"loadbalancer"},
+	}
+}
+
+func TestExpandVolumes(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       []interface{}
+		expected []v1alpha5.VolumeWithNodeFilters
+	}{
+		{"none", nil, nil},
+		{
+			"destination",
+			[]interface{}{map[string]interface{}{"source": "", "destination": "/data", "node_filters": []interface{}{}}},
+			[]v1alpha5.VolumeWithNodeFilters{{Volume: "/data"}},
+		},
+		{
+			"source",
+			[]interface{}{map[string]interface{}{"source": "/tmp/foo", "destination": "/foo", "node_filters": []interface{}{"server:0", "agent:*"}}},
+			[]v1alpha5.VolumeWithNodeFilters{{Volume: "/tmp/foo:/foo", NodeFilters: []string{"server:0", "agent:*"}}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if volumes := expandVolumes(c.in); !reflect.DeepEqual(volumes, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, volumes)
+			}
+		})
+	}
+}
+
+func TestExpandEnvVars(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       []interface{}
+		expected []v1alpha5.EnvVarWithNodeFilters
+	}{
+		{"none", nil, nil},
+		{
+			"env",
+			[]interface{}{
+				map[string]interface{}{"key": "FOO", "value": "bar", "node_filters": []interface{}{"server:*"}},
+				map[string]interface{}{"key": "EMPTY", "value": "", "node_filters": []interface{}{}},
+			},
+			[]v1alpha5.EnvVarWithNodeFilters{
+				{EnvVar: "FOO=bar", NodeFilters: []string{"server:*"}},
+				{EnvVar: "EMPTY="},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if envVars := expandEnvVars(c.in); !reflect.DeepEqual(envVars, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, envVars)
+			}
+		})
+	}
+}
+
+func TestExpandLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       []interface{}
+		expected []v1alpha5.LabelWithNodeFilters
+	}{
+		{"none", nil, nil},
+		{
+			"labels",
+			[]interface{}{
+				map[string]interface{}{"key": "foo", "value": "bar", "node_filters": []interface{}{"agent:*"}},
+				map[string]interface{}{"key": "bar", "value": "", "node_filters": []interface{}{}},
+			},
+			[]v1alpha5.LabelWithNodeFilters{
+				{Label: "foo=bar", NodeFilters: []string{"agent:*"}},
+				{Label: "bar="},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if labels := expandLabels(c.in); !reflect.DeepEqual(labels, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, labels)
+			}
+		})
+	}
+}
+
+func TestExpandExposureOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       []interface{}
+		expected v1alpha5.SimpleExposureOpts
+	}{
+		{
+			"host port",
+			[]interface{}{map[string]interface{}{"host": "k3d.localhost", "host_ip": "127.0.0.1", "host_port": 6443}},
+			v1alpha5.SimpleExposureOpts{Host: "k3d.localhost", HostIP: "127.0.0.1", HostPort: "6443"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if opts := expandExposureOptions(c.in); !reflect.DeepEqual(opts, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, opts)
+			}
+		})
+	}
+
+	// without a host port, a free one is picked
+	for _, in := range [][]interface{}{nil, {map[string]interface{}{"host": "", "host_ip": "", "host_port": 0}}} {
+		opts := expandExposureOptions(in)
+		if port, err := strconv.Atoi(opts.HostPort); err != nil || port == 0 {
+			t.Errorf("expected a free host port, got %#v", opts)
+		}
+	}
+}
+
+func TestExpandConfigOptionsK3s(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       []interface{}
+		expected v1alpha5.SimpleConfigOptionsK3s
+	}{
+		{"none", nil, v1alpha5.SimpleConfigOptionsK3s{}},
+		{
+			"no extra args",
+			[]interface{}{map[string]interface{}{"extra_args": []interface{}{}}},
+			v1alpha5.SimpleConfigOptionsK3s{ExtraArgs: []v1alpha5.K3sArgWithNodeFilters{}},
+		},
+		{
+			"extra args",
+			[]interface{}{map[string]interface{}{"extra_args": []interface{}{
+				map[string]interface{}{"arg": "--disable=traefik", "node_filters": []interface{}{"server:*"}},
+				map[string]interface{}{"arg": "--node-taint=foo=bar:NoSchedule", "node_filters": []interface{}{}},
+			}}},
+			v1alpha5.SimpleConfigOptionsK3s{ExtraArgs: []v1alpha5.K3sArgWithNodeFilters{
+				{Arg: "--disable=traefik", NodeFilters: []string{"server:*"}},
+				{Arg: "--node-taint=foo=bar:NoSchedule"},
+			}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if opts := expandConfigOptionsK3s(c.in); !reflect.DeepEqual(opts, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, opts)
+			}
+		})
+	}
+}
+
+// TestGetSimpleConfig pins the k3d config built from each cluster
+// configuration of testdata/simple_config, in Terraform JSON syntax, to its
+// golden file. Run the tests with -update to write the golden files. The
+// configurations set the API port, a free one is picked otherwise.
+func TestGetSimpleConfig(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "simple_config", "*.tf.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no cluster configurations found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".tf.json")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw := map[string]interface{}{}
+			if err := json.Unmarshal(content, &raw); err != nil {
+				t.Fatal(err)
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceCluster().Schema, raw)
+			simpleConfig, err := getSimpleConfig(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := yaml.Marshal(simpleConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "simple_config", name+".golden.yaml")
+			if *update {
+				if err := os.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != string(expected) {
+				t.Errorf("k3d config differs from %s:\n%s", golden, actual)
+			}
+		})
+	}
+}
+
+func TestRollbackClusterCreate(t *testing.T) {
+	ctx := context.Background()
+	cluster := &types.Cluster{Name: "foo", Network: types.ClusterNetwork{Name: "k3d-foo"}}
+	createErr := errors.New("Failed Cluster Start: Failed to start server k3d-foo-server-0: context deadline exceeded")
+
+	newRuntime := func(t *testing.T, withNodes bool) *fakeRuntime {
+		runtime := newFakeRuntime()
+		if _, _, err := runtime.CreateNetworkIfNotPresent(ctx, &cluster.Network); err != nil {
+			t.Fatal(err)
+		}
+		if !withNodes {
+			return runtime
+		}
+
+		labels := map[string]string{types.LabelClusterName: "foo"}
+		if err := runtime.CreateVolume(ctx, "k3d-foo-images", labels); err != nil {
+			t.Fatal(err)
+		}
+		node := &types.Node{
+			Name:          "k3d-foo-server-0",
+			Role:          types.ServerRole,
+			Networks:      []string{"k3d-foo"},
+			RuntimeLabels: map[string]string{"app": "k3d", types.LabelClusterName: "foo", types.LabelNetwork: "k3d-foo", types.LabelRole: string(types.ServerRole)},
+		}
+		if err := runtime.CreateNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		if err := runtime.StartNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		return runtime
+	}
+
+	summaries := func(diags diag.Diagnostics) []string {
+		var summaries []string
+		for _, d := range diags {
+			summaries = append(summaries, d.Summary)
+		}
+		return summaries
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		runtime := newRuntime(t, true)
+		diags := rollbackClusterCreate(ctx, testMeta(runtime).(*apiClient), cluster, createErr, false)
+
+		expected := []string{"Failed to create cluster", "Last logs of node k3d-foo-server-0"}
+		if actual := summaries(diags); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+		if diags[0].Detail != createErr.Error() {
+			t.Errorf("unexpected detail: %s", diags[0].Detail)
+		}
+		if !strings.Contains(diags[1].Detail, types.ReadyLogMessagesByRoleAndIntent[types.ServerRole][types.IntentClusterCreate]) {
+			t.Errorf("missing logs: %s", diags[1].Detail)
+		}
+		if leftovers := clusterLeftovers(ctx, runtime, cluster); leftovers != "Nothing was left behind." {
+			t.Errorf("unexpected leftovers: %s", leftovers)
+		}
+	})
+
+	t.Run("keep_on_failure", func(t *testing.T) {
+		runtime := newRuntime(t, true)
+		diags := rollbackClusterCreate(ctx, testMeta(runtime).(*apiClient), cluster, createErr, true)
+
+		expected := []string{"Failed to create cluster", "Last logs of node k3d-foo-server-0", "Cluster kept for debugging"}
+		if actual := summaries(diags); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+		if !strings.HasSuffix(diags[2].Detail, "Left behind:\n- containers: k3d-foo-server-0\n- network: k3d-foo\n- volumes: k3d-foo-images") {
+			t.Errorf("unexpected detail: %s", diags[2].Detail)
+		}
+		if runtime.node("k3d-foo-server-0") == nil {
+			t.Error("expected the node to be kept")
+		}
+	})
+
+	t.Run("failed rollback", func(t *testing.T) {
+		runtime := newRuntime(t, false)
+		diags := rollbackClusterCreate(ctx, testMeta(runtime).(*apiClient), cluster, createErr, false)
+
+		expected := []string{"Failed to create cluster", "Failed to roll back cluster creation"}
+		if actual := summaries(diags); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+		if !strings.HasSuffix(diags[1].Detail, "Left behind:\n- network: k3d-foo") {
+			t.Errorf("unexpected detail: %s", diags[1].Detail)
+		}
+	})
+}
+
+func TestResourceCluster_fake(t *testing.T) {
+	testFakeClusterEnv(t)
+	runtime := newFakeRuntime()
+	meta := testMeta(runtime)
+	r := resourceCluster()
+	config := testFakeClusterConfig("foo")
+
+	state := testApply(t, r, nil, config, meta)
+	if state.ID != "foo" {
+		t.Fatalf("unexpected ID %q", state.ID)
+	}
+	server := runtime.node("k3d-foo-server-0")
+	if server == nil || !server.State.Running {
+		t.Fatal("expected the server to be running")
+	}
+	if server.Image != config["image"] {
+		t.Errorf("unexpected image %q", server.Image)
+	}
+	if state.Attributes["token"] == "" {
+		t.Error("expected the token of the cluster in state")
+	}
+
+	config["token"] = "new-token"
+	state = testApply(t, r, state, config, meta)
+	if actual := state.Attributes["token"]; actual != "new-token" {
+		t.Errorf("expected the token to be rotated, got %q", actual)
+	}
+	if execs := runtime.execs["k3d-foo-server-0"]; len(execs) == 0 || !strings.Contains(strings.Join(execs[len(execs)-1], " "), "token rotate") {
+		t.Errorf("expected the token to be rotated in the server, got %v", execs)
+	}
+
+	state, diags := r.RefreshWithoutUpgrade(context.Background(), state, meta)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if actual := state.Attributes["token"]; actual != "new-token" {
+		t.Errorf("expected the rotated token to be read, got %q", actual)
+	}
+
+	testDestroy(t, r, state, meta)
+	if len(runtime.nodes) > 0 || len(runtime.volumes) > 0 {
+		t.Errorf("expected the cluster to be gone, got nodes %v and volumes %v", runtime.nodes, runtime.volumes)
+	}
+}
+
+func TestResourceCluster_imageDefault(t *testing.T) {
+	// the latest stable release is looked up on creation, not while planning
+	config := testFakeClusterConfig("foo")
+	delete(config, "image")
+
+	diff, err := resourceCluster().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), testMeta(newFakeRuntime()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := diff.Attributes["image"]; image == nil || !image.NewComputed {
+		t.Errorf("expected the image to be known after apply, got %+v", image)
+	}
 }
-`
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+func resourceEtcdSnapshot() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Snapshot of the embedded etcd of a k3d cluster with several servers, copied to the host.",
+
+		CreateContext: resourceEtcdSnapshotCreate,
+		ReadContext:   resourceEtcdSnapshotRead,
+		DeleteContext: resourceEtcdSnapshotDelete,
+
+		Schema: map[string]*schema.Schema{
+			"cluster": {
+				Description: "Cluster name.",
+				ForceNew:    true,
+				Required:    true,
+				Type:        schema.TypeString,
+			},
+			"host_path": {
+				Description: "Directory on the host to copy the snapshot to.",
+				ForceNew:    true,
+				Required:    true,
+				Type:        schema.TypeString,
+			},
+			"name": {
+				Description:  "Snapshot name, k3s appends the node name and a timestamp to it.",
+				ForceNew:     true,
+				Optional:     true,
+				Type:         schema.TypeString,
+				Default:      "on-demand",
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`), "must only contain letters, digits, '_', '.' and '-'"),
+			},
+			"node": {
+				Description:      "Server node to take the snapshot on, with or without the `k3d-` prefix. Defaults to the first server.",
+				Computed:         true,
+				ForceNew:         true,
+				Optional:         true,
+				Type:             schema.TypeString,
+				DiffSuppressFunc: suppressEquivalentContainerName,
+			},
+			"path": {
+				Description: "Path of the snapshot on the host.",
+				Computed:    true,
+				Type:        schema.TypeString,
+			},
+			"size": {
+				Description: "Size of the snapshot in bytes.",
+				Computed:    true,
+				Type:        schema.TypeInt,
+			},
+			"snapshot_name": {
+				Description: "Name of the snapshot as saved by k3s.",
+				Computed:    true,
+				Type:        schema.TypeString,
+			},
+		},
+	}
+}
+
+func resourceEtcdSnapshotCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	clusterName := d.Get("cluster").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	servers := util.FilterNodesByRole(cluster.Nodes, types.ServerRole)
+	if !hasEmbeddedEtcd(servers) {
+		return diag.Errorf("cluster '%s' doesn't run the embedded etcd, it needs more than one server", clusterName)
+	}
+
+	nodeID := client.GenerateNodeName(clusterName, types.ServerRole, 0)
+	if node, ok := d.GetOk("node"); ok {
+		nodeID = containerName(node.(string))
+	}
+
+	var server *types.Node
+	for _, node := range servers {
+		if node.Name == nodeID {
+			server = node
+		}
+	}
+	if server == nil {
+		return diag.Errorf("server '%s' not found in cluster '%s'", nodeID, clusterName)
+	}
+
+	snapshotPath, err := saveEtcdSnapshot(ctx, runtime, server, d.Get("name").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	snapshotName := path.Base(snapshotPath)
+	hostPath, err := filepath.Abs(filepath.Join(d.Get("host_path").(string), snapshotName))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	tflog.Info(ctx, "Copying etcd snapshot", map[string]interface{}{"snapshot": snapshotName, "path": hostPath})
+
+	if _, err := copyFileFromNode(ctx, runtime, server, snapshotPath, hostPath); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(hostPath)
+	if err := d.Set("node", server.Name); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("snapshot_name", snapshotName); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourceEtcdSnapshotRead(ctx, d, meta)
+}
+
+func resourceEtcdSnapshotRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	hostPath := d.Id()
+
+	info, err := os.Stat(hostPath)
+	if os.IsNotExist(err) {
+		log.Printf("[WARN] Etcd snapshot %s not found, removing from state", hostPath)
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("path", hostPath); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("size", int(info.Size())); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceEtcdSnapshotDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	clusterName := d.Get("cluster").(string)
+	ctx = tflog.SetField(ctx, "cluster", clusterName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if err := os.Remove(d.Id()); err != nil && !os.IsNotExist(err) {
+		return diag.FromErr(err)
+	}
+
+	// the snapshot in the node goes away with the cluster anyway
+	node, err := getNode(ctx, runtime, d.Get("node").(string))
+	if err == nil && node != nil {
+		err = runtime.ExecInNode(ctx, node, []string{"k3s", "etcd-snapshot", "delete", d.Get("snapshot_name").(string)})
+	}
+	if err != nil {
+		log.Printf("[WARN] Failed to delete etcd snapshot %s from node %s", d.Get("snapshot_name").(string), d.Get("node").(string))
+		log.Printf("[WARN] %s", err)
+	}
+
+	return nil
+}
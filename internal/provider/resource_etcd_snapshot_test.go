@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestAccResourceEtcdSnapshot(t *testing.T) {
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceEtcdSnapshot(name, t.TempDir()),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr(
+						"k3d_etcd_snapshot.foo", "snapshot_name", regexp.MustCompile(fmt.Sprintf("^bar-k3d-%s-server-0-", name))),
+					resource.TestCheckResourceAttr(
+						"k3d_etcd_snapshot.foo", "node", fmt.Sprintf("k3d-%s-server-0", name)),
+				),
+			},
+		},
+	})
+}
+
+func testAccResourceEtcdSnapshot(name string, hostPath string) string {
+	return fmt.Sprintf(`
+resource "k3d_cluster" "foo" {
+  name    = %q
+  servers = 3
+}
+
+resource "k3d_etcd_snapshot" "foo" {
+  cluster   = k3d_cluster.foo.name
+  name      = "bar"
+  host_path = %q
+}
+`, name, hostPath)
+}
+
+func TestHasEmbeddedEtcd(t *testing.T) {
+	cases := []struct {
+		name     string
+		servers  []*types.Node
+		expected bool
+	}{
+		{"single server", []*types.Node{{Cmd: []string{"server"}}}, false},
+		{"cluster init", []*types.Node{{Cmd: []string{"server", "--cluster-init"}}}, true},
+		{"cluster init arg", []*types.Node{{Cmd: []string{"server"}, Args: []string{"--cluster-init"}}}, true},
+		{"several servers", []*types.Node{{Cmd: []string{"server"}}, {Cmd: []string{"server"}}}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if embedded := hasEmbeddedEtcd(c.servers); embedded != c.expected {
+				t.Errorf("expected %t, got %t", c.expected, embedded)
+			}
+		})
+	}
+}
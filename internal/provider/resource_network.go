@@ -0,0 +1,292 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+var (
+	_ resource.ResourceWithConfigure      = &networkResource{}
+	_ resource.ResourceWithImportState    = &networkResource{}
+	_ resource.ResourceWithValidateConfig = &networkResource{}
+)
+
+func newNetworkResource() resource.Resource {
+	return &networkResource{}
+}
+
+type networkResource struct {
+	client *apiClient
+}
+
+type networkResourceModel struct {
+	ID        fwtypes.String `tfsdk:"id"`
+	Name      fwtypes.String `tfsdk:"name"`
+	Gateway   fwtypes.String `tfsdk:"gateway"`
+	NetworkID fwtypes.String `tfsdk:"network_id"`
+	Subnet    fwtypes.String `tfsdk:"subnet"`
+}
+
+func (r *networkResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_network"
+}
+
+func (r *networkResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "k3d-managed network, to be joined by clusters, nodes and registries through their `network` attribute.",
+
+		Attributes: map[string]schema.Attribute{
+			"id": idAttribute(),
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Network name.",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"gateway": schema.StringAttribute{
+				MarkdownDescription: "Gateway of the network, within `subnet`, which must be set along with it. By default, the first host address of the subnet.",
+				Computed:            true,
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIfConfigured(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+				Validators: []validator.String{
+					ipAddressValidator{},
+				},
+			},
+			"network_id": schema.StringAttribute{
+				MarkdownDescription: "ID of the network in the runtime.",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"subnet": schema.StringAttribute{
+				MarkdownDescription: "Subnet of the network in CIDR notation. By default, the runtime picks one.",
+				Computed:            true,
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIfConfigured(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+				Validators: []validator.String{
+					cidrValidator{},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks that the gateway lies in the subnet, which docker
+// requires along with it.
+func (r *networkResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config networkResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if config.Gateway.IsNull() || config.Gateway.IsUnknown() || config.Subnet.IsUnknown() {
+		return
+	}
+
+	if config.Subnet.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("gateway"), "Invalid gateway", "The gateway can only be set along with the subnet.")
+		return
+	}
+
+	// syntax errors are reported by the attribute validators
+	prefix, err := netip.ParsePrefix(config.Subnet.ValueString())
+	if err != nil {
+		return
+	}
+	gateway, err := netip.ParseAddr(config.Gateway.ValueString())
+	if err != nil {
+		return
+	}
+
+	if !prefix.Contains(gateway) || gateway == prefix.Masked().Addr() {
+		resp.Diagnostics.AddAttributeError(path.Root("gateway"), "Invalid gateway", fmt.Sprintf("The gateway %s must be a host address of the subnet %s.", gateway, prefix))
+	}
+}
+
+func (r *networkResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	r.client = configureClient(req.ProviderData, &resp.Diagnostics)
+}
+
+func (r *networkResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan networkResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	networkName := plan.Name.ValueString()
+	ctx = tflog.SetField(ctx, "network", networkName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := r.client.runtime
+
+	network := &types.ClusterNetwork{Name: networkName}
+	if !plan.Subnet.IsNull() && !plan.Subnet.IsUnknown() {
+		prefix, err := netip.ParsePrefix(plan.Subnet.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("subnet"), "Invalid subnet", err.Error())
+			return
+		}
+		network.IPAM = types.IPAM{IPPrefix: prefix, Managed: true}
+	}
+
+	var exists bool
+	var err error
+	if gateway, ok := plannedGateway(plan, network); ok {
+		pr, supported := asProviderRuntime(runtime)
+		if !supported {
+			resp.Diagnostics.AddAttributeError(path.Root("gateway"), "Failed to create network", fmt.Sprintf("Setting the gateway is not supported by the %s runtime", runtime.ID()))
+			return
+		}
+		_, exists, err = pr.CreateNetworkWithGateway(ctx, network, gateway)
+	} else {
+		_, exists, err = runtime.CreateNetworkIfNotPresent(ctx, network)
+	}
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to create network", err.Error())
+		return
+	}
+	if exists {
+		resp.Diagnostics.AddError("Failed to create network", "A network with that name already exists")
+		return
+	}
+
+	state, err := r.read(ctx, networkName)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read network", err.Error())
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+// plannedGateway returns the gateway planned for network, unless left to the
+// runtime, which picks the first host address of the subnet.
+func plannedGateway(plan networkResourceModel, network *types.ClusterNetwork) (netip.Addr, bool) {
+	if plan.Gateway.IsNull() || plan.Gateway.IsUnknown() {
+		return netip.Addr{}, false
+	}
+
+	gateway, err := netip.ParseAddr(plan.Gateway.ValueString())
+	if err != nil || gateway == network.IPAM.IPPrefix.Addr().Next() {
+		return netip.Addr{}, false
+	}
+
+	return gateway, true
+}
+
+func (r *networkResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state networkResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	networkName := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "network", networkName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+
+	newState, err := r.read(ctx, networkName)
+	if errors.Is(err, runtimeErrors.ErrRuntimeNetworkNotExists) {
+		tflog.Warn(ctx, "Network not found, removing from state")
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read network", err.Error())
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, newState)...)
+}
+
+func (r *networkResource) read(ctx context.Context, networkName string) (*networkResourceModel, error) {
+	network, err := r.client.runtime.GetNetwork(ctx, &types.ClusterNetwork{Name: networkName})
+	if err != nil {
+		return nil, err
+	}
+
+	subnet, gateway := "", ""
+	if network.IPAM.IPPrefix.IsValid() {
+		subnet = network.IPAM.IPPrefix.String()
+	}
+	// the runtime reports the gateway as the first address used
+	if len(network.IPAM.IPsUsed) > 0 {
+		gateway = network.IPAM.IPsUsed[0].String()
+	}
+
+	return &networkResourceModel{
+		ID:        fwtypes.StringValue(network.Name),
+		Name:      fwtypes.StringValue(network.Name),
+		Gateway:   fwtypes.StringValue(gateway),
+		NetworkID: fwtypes.StringValue(network.ID),
+		Subnet:    fwtypes.StringValue(subnet),
+	}, nil
+}
+
+// Update is never called: changing the name, the subnet or the gateway
+// replaces the network, the other attributes are computed.
+func (r *networkResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	resp.Diagnostics.AddError("Failed to update network", "Networks can't be updated in place")
+}
+
+func (r *networkResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state networkResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	networkName := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "network", networkName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := r.client.runtime
+
+	nodes, err := runtime.GetNodesInNetwork(ctx, networkName)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to delete network", err.Error())
+		return
+	}
+	if len(nodes) > 0 {
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		resp.Diagnostics.AddError("Failed to delete network", fmt.Sprintf("k3d nodes are still attached to network %s: %s", networkName, strings.Join(names, ", ")))
+		return
+	}
+
+	if err := runtime.DeleteNetwork(ctx, networkName); err != nil {
+		resp.Diagnostics.AddError("Failed to delete network", err.Error())
+	}
+}
+
+func (r *networkResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
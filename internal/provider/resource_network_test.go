@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestAccResourceNetwork(t *testing.T) {
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceNetwork(name),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"k3d_network.foo", "subnet", "172.28.0.0/16"),
+					resource.TestCheckResourceAttr(
+						"k3d_network.foo", "gateway", "172.28.0.254"),
+					resource.TestCheckResourceAttr(
+						"k3d_cluster.foo", "network", name),
+				),
+			},
+			{
+				ResourceName:      "k3d_network.foo",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func testAccResourceNetwork(name string) string {
+	return fmt.Sprintf(`
+resource "k3d_network" "foo" {
+  name    = %[1]q
+  subnet  = "172.28.0.0/16"
+  gateway = "172.28.0.254"
+}
+
+resource "k3d_cluster" "foo" {
+  name    = %[1]q
+  network = k3d_network.foo.name
+}
+`, name)
+}
+
+func TestResourceNetwork_fakeRuntime(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	r, s := testResource(t, newNetworkResource, runtime)
+
+	createResp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name":   tftypes.NewValue(tftypes.String, "foo"),
+		"subnet": tftypes.NewValue(tftypes.String, "172.30.0.0/24"),
+	})}, &createResp)
+	if createResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", createResp.Diagnostics)
+	}
+
+	var state networkResourceModel
+	createResp.State.Get(ctx, &state)
+	if id := state.ID.ValueString(); id != "foo" {
+		t.Errorf("expected ID foo, got %s", id)
+	}
+	if gateway := state.Gateway.ValueString(); gateway != "172.30.0.1" {
+		t.Errorf("expected gateway 172.30.0.1, got %s", gateway)
+	}
+	if subnet := state.Subnet.ValueString(); subnet != "172.30.0.0/24" {
+		t.Errorf("expected subnet 172.30.0.0/24, got %s", subnet)
+	}
+
+	// the network exists already
+	resp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name": tftypes.NewValue(tftypes.String, "foo"),
+	})}, &resp)
+	if !resp.Diagnostics.HasError() {
+		t.Error("expected an error creating the network twice")
+	}
+
+	// attached nodes prevent the deletion
+	if err := runtime.CreateNode(ctx, &types.Node{Name: "k3d-bar", Networks: []string{"foo"}}); err != nil {
+		t.Fatal(err)
+	}
+	deleteResp := fwresource.DeleteResponse{State: createResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: createResp.State}, &deleteResp)
+	if !deleteResp.Diagnostics.HasError() {
+		t.Error("expected an error deleting the network with nodes attached")
+	}
+	if err := runtime.DeleteNode(ctx, &types.Node{Name: "k3d-bar"}); err != nil {
+		t.Fatal(err)
+	}
+	deleteResp = fwresource.DeleteResponse{State: createResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: createResp.State}, &deleteResp)
+	if deleteResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", deleteResp.Diagnostics)
+	}
+
+	// the network is gone from the state once deleted
+	readResp := fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", readResp.Diagnostics)
+	}
+	if !readResp.State.Raw.IsNull() {
+		t.Error("expected the network to be removed from state")
+	}
+}
+
+func TestResourceNetwork_gateway(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	r, s := testResource(t, newNetworkResource, runtime)
+
+	createResp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name":    tftypes.NewValue(tftypes.String, "foo"),
+		"subnet":  tftypes.NewValue(tftypes.String, "172.30.0.0/24"),
+		"gateway": tftypes.NewValue(tftypes.String, "172.30.0.254"),
+	})}, &createResp)
+	if createResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", createResp.Diagnostics)
+	}
+
+	var state networkResourceModel
+	createResp.State.Get(ctx, &state)
+	if gateway := state.Gateway.ValueString(); gateway != "172.30.0.254" {
+		t.Errorf("expected gateway 172.30.0.254, got %s", gateway)
+	}
+}
+
+func TestResourceNetwork_validateConfig(t *testing.T) {
+	cases := []struct {
+		subnet  interface{}
+		gateway interface{}
+		valid   bool
+	}{
+		{"172.30.0.0/24", "172.30.0.254", true},
+		{"172.30.0.0/24", "172.30.0.1", true},
+		{nil, nil, true},
+		{"172.30.0.0/24", nil, true},
+		{"172.30.0.0/24", tftypes.UnknownValue, true},
+		{nil, "172.30.0.1", false},
+		{"172.30.0.0/24", "172.31.0.1", false},
+		{"172.30.0.0/24", "172.30.0.0", false},
+	}
+
+	r, s := testResource(t, newNetworkResource, newFakeRuntime())
+	for _, c := range cases {
+		config := testPlan(t, s, map[string]tftypes.Value{
+			"id":         tftypes.NewValue(tftypes.String, nil),
+			"name":       tftypes.NewValue(tftypes.String, "foo"),
+			"network_id": tftypes.NewValue(tftypes.String, nil),
+			"subnet":     tftypes.NewValue(tftypes.String, c.subnet),
+			"gateway":    tftypes.NewValue(tftypes.String, c.gateway),
+		})
+
+		resp := fwresource.ValidateConfigResponse{}
+		r.(fwresource.ResourceWithValidateConfig).ValidateConfig(context.Background(), fwresource.ValidateConfigRequest{
+			Config: tfsdk.Config{Schema: s, Raw: config.Raw},
+		}, &resp)
+
+		if resp.Diagnostics.HasError() == c.valid {
+			t.Errorf("%v in %v: expected valid to be %t, got %v", c.gateway, c.subnet, c.valid, resp.Diagnostics)
+		}
+	}
+}
+
+func TestCidrValidator(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"10.0.0.0/24", true},
+		{"fd00::/64", true},
+		{"10.0.0.1/24", false},
+		{"10.0.0.0", false},
+	}
+
+	for _, c := range cases {
+		resp := validator.StringResponse{}
+		cidrValidator{}.ValidateString(context.Background(), validator.StringRequest{
+			Path:        path.Root("subnet"),
+			ConfigValue: fwtypes.StringValue(c.value),
+		}, &resp)
+
+		if resp.Diagnostics.HasError() == c.valid {
+			t.Errorf("%s: expected valid to be %t, got %v", c.value, c.valid, resp.Diagnostics)
+		}
+	}
+}
@@ -3,11 +3,19 @@ package provider
 import (
 	"context"
 	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
 
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 
+	"github.com/k3d-io/k3d/v5/pkg/actions"
 	"github.com/k3d-io/k3d/v5/pkg/client"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
@@ -15,53 +23,184 @@ import (
 )
 
 func resourceNode() *schema.Resource {
-	k3dVersion, err := version.GetK3sVersion("stable")
-	if err != nil {
-		panic(err)
+	nodeSchema := nodeSchema()
+	nodeSchema["name"] = &schema.Schema{
+		Description:      "Node name, with or without the `k3d-` prefix.",
+		ForceNew:         true,
+		Required:         true,
+		Type:             schema.TypeString,
+		DiffSuppressFunc: suppressEquivalentContainerName,
+	}
+	nodeSchema["container_name"] = &schema.Schema{
+		Description: "Name of the node container.",
+		Computed:    true,
+		Type:        schema.TypeString,
+	}
+	nodeSchema["port"] = &schema.Schema{
+		Description: "Map ports from the node container to the host.",
+		ForceNew:    true,
+		Optional:    true,
+		Type:        schema.TypeList,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"host": {
+					ForceNew:     true,
+					Optional:     true,
+					Type:         schema.TypeString,
+					ValidateFunc: validation.IsIPAddress,
+				},
+				"host_port": {
+					ForceNew:     true,
+					Optional:     true,
+					Type:         schema.TypeInt,
+					ValidateFunc: validation.IsPortNumber,
+				},
+				"container_port": {
+					ForceNew:     true,
+					Required:     true,
+					Type:         schema.TypeInt,
+					ValidateFunc: validation.IsPortNumber,
+				},
+				"protocol": {
+					ForceNew:     true,
+					Optional:     true,
+					Type:         schema.TypeString,
+					Default:      "TCP",
+					ValidateFunc: validation.StringInSlice([]string{"TCP", "UDP"}, true),
+				},
+			},
+		},
 	}
+
 	return &schema.Resource{
 		// This description is used by the documentation generator and the language server.
 		Description: "Containerized k3s node (k3s in docker).",
 
 		CreateContext: resourceNodeCreate,
 		ReadContext:   resourceNodeRead,
-		// UpdateContext: resourceNodeUpdate,
+		UpdateContext: resourceNodeUpdate,
 		DeleteContext: resourceNodeDelete,
 
-		Schema: map[string]*schema.Schema{
-			"name": {
-				Description: "Node name.",
-				ForceNew:    true,
-				Required:    true,
-				Type:        schema.TypeString,
-			},
-			"cluster": {
-				Description: "Select the cluster that the node shall connect to.",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
-				Default:     types.DefaultClusterName,
-			},
-			"image": {
-				Description: "Specify k3s image used for the node(s).",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
-				Default:     fmt.Sprintf("%s:%s", types.DefaultK3sImageRepo, k3dVersion),
-			},
-			"memory": {
-				Description: "Memory limit imposed on the node [From docker]",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceNodeImport,
+		},
+
+		CustomizeDiff: customdiff.All(
+			forceNewIfMemoryLimitToggled("memory"),
+			checkNewHostPorts(false, func(d *schema.ResourceDiff, node *types.Node) bool {
+				return node.Name == containerName(d.Get("name").(string))
+			}),
+		),
+
+		Schema: nodeSchema,
+	}
+}
+
+// nodeSchema returns the attributes shared by every resource creating nodes
+// in an existing cluster.
+func nodeSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"cluster": {
+			Description: "Select the cluster that the node shall connect to.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeString,
+			Default:     types.DefaultClusterName,
+		},
+		"image": {
+			Description: "Specify k3s image used for the node(s). Defaults to the latest stable k3s release at creation.",
+			ForceNew:    true,
+			Optional:    true,
+			Computed:    true,
+			Type:        schema.TypeString,
+		},
+		"memory": {
+			Description: "Memory limit imposed on the node [From docker]. Changing the limit restarts the node and leaves it no swap on top of it, setting or removing it replaces the node.",
+			Optional:    true,
+			Type:        schema.TypeString,
+		},
+		"role": {
+			Description:  "Specify node role [server, agent].",
+			ForceNew:     true,
+			Optional:     true,
+			Type:         schema.TypeString,
+			Default:      string(types.AgentRole),
+			ValidateFunc: validation.StringInSlice([]string{string(types.AgentRole), string(types.ServerRole)}, true),
+		},
+		"env": {
+			Description: "Add environment variables to the node.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeList,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"key": {
+						ForceNew: true,
+						Required: true,
+						Type:     schema.TypeString,
+					},
+					"value": {
+						ForceNew: true,
+						Optional: true,
+						Type:     schema.TypeString,
+					},
+				},
 			},
-			"role": {
-				Description:  "Specify node role [server, agent].",
-				ForceNew:     true,
-				Optional:     true,
-				Type:         schema.TypeString,
-				Default:      string(types.AgentRole),
-				ValidateFunc: validation.StringInSlice([]string{string(types.AgentRole), string(types.ServerRole)}, true),
+		},
+		"k3s_extra_args": {
+			Description: "Additional args passed to the k3s command.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeList,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"k3s_node_labels": {
+			Description: "Add label to the k3s node.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeMap,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"networks": {
+			Description: "Additional networks to connect the node to, the cluster network is always attached.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeList,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"restart_policy": {
+			Description:  "Restart policy of the node container [unless-stopped, no].",
+			ForceNew:     true,
+			Optional:     true,
+			Type:         schema.TypeString,
+			Default:      "unless-stopped",
+			ValidateFunc: validation.StringInSlice([]string{"unless-stopped", "no"}, false),
+		},
+		"runtime_labels": {
+			Description: "Add label to the node container.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeMap,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"volume": {
+			Description: "Mount volumes into the node.",
+			ForceNew:    true,
+			Optional:    true,
+			Type:        schema.TypeList,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"source": {
+						ForceNew: true,
+						Optional: true,
+						Type:     schema.TypeString,
+					},
+					"destination": {
+						ForceNew: true,
+						Required: true,
+						Type:     schema.TypeString,
+					},
+				},
 			},
 		},
 	}
@@ -69,57 +208,489 @@ func resourceNode() *schema.Resource {
 
 func resourceNodeCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	clusterName := d.Get("cluster").(string)
-	nodeName := d.Get("name").(string)
-	nodeID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, nodeName)
-
-	node := &types.Node{
-		Name:  nodeID,
-		Role:  types.NodeRoles[d.Get("role").(string)],
-		Image: d.Get("image").(string),
-		K3sNodeLabels: map[string]string{
-			types.LabelRole: d.Get("role").(string),
-		},
-		Restart: true,
-		Memory:  d.Get("memory").(string),
+	nodeID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node", nodeID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if err := setDefaultK3sImage(d); err != nil {
+		return diag.FromErr(err)
 	}
 
-	if err := client.NodeAddToCluster(ctx, runtimes.SelectedRuntime, node, &types.Cluster{Name: clusterName}, types.NodeCreateOpts{}); err != nil {
+	node, err := expandNode(d, nodeID)
+	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	if err := addNodesToCluster(ctx, runtime, clusterName, []*types.Node{node}); err != nil {
+		diags := diag.FromErr(err)
+		// the container is left behind when it fails to start
+		if failed, getErr := getNode(ctx, runtime, nodeID); getErr == nil && failed != nil {
+			diags = append(diags, removeFailedNodes(ctx, meta.(*apiClient), []*types.Node{failed})...)
+		}
+		return diags
+	}
+
 	d.SetId(nodeID)
 
 	return resourceNodeRead(ctx, d, meta)
 }
 
 func resourceNodeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	nodeName := d.Get("name").(string)
-	nodeID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, nodeName)
+	nodeID := d.Id()
+	ctx = tflog.SetField(ctx, "node", nodeID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 
-	_, err := client.NodeGet(ctx, runtimes.SelectedRuntime, &types.Node{Name: nodeID})
+	node, err := getNode(ctx, runtime, nodeID)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	if node == nil {
+		log.Printf("[WARN] Node %s not found, removing from state", nodeID)
+		d.SetId("")
+		return nil
+	}
+
+	if err := d.Set("container_name", node.Name); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("cluster", node.RuntimeLabels[types.LabelClusterName]); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("role", node.RuntimeLabels[types.LabelRole]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	restartPolicy := "no"
+	if node.Restart {
+		restartPolicy = "unless-stopped"
+	}
+	if err := d.Set("restart_policy", restartPolicy); err != nil {
+		return diag.FromErr(err)
+	}
+
+	image, err := getNodeImage(ctx, runtime, node)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("image", image); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// k3d reports the memory limit in a human readable form, keep the
+	// configured value as long as it amounts to the same limit
+	if !memoryEqual(d.Get("memory").(string), node.Memory) {
+		if err := d.Set("memory", node.Memory); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
 	return nil
 }
 
-/*
+func resourceNodeImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	nodeID := containerName(d.Id())
+	d.SetId(nodeID)
+
+	if err := d.Set("name", strings.TrimPrefix(nodeID, types.DefaultObjectNamePrefix+"-")); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceNodeUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	// use the meta value to retrieve your client from the provider configure method
-	// client := meta.(*apiClient)
+	nodeID := d.Id()
+	ctx = tflog.SetField(ctx, "node", nodeID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if d.HasChange("memory") {
+		node, err := client.NodeGet(ctx, runtime, &types.Node{Name: nodeID})
+		if err != nil {
+			return diag.FromErr(err)
+		}
 
-	return diag.Errorf("not implemented")
+		if err := updateNodeMemory(ctx, runtime, node, d.Get("memory").(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceNodeRead(ctx, d, meta)
 }
-*/
 
 func resourceNodeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	nodeName := d.Get("name").(string)
-	nodeID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, nodeName)
+	nodeID := d.Id()
+	ctx = tflog.SetField(ctx, "node", nodeID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
 
-	if err := client.NodeDelete(ctx, runtimes.SelectedRuntime, &types.Node{Name: nodeID}, types.NodeDeleteOpts{}); err != nil {
+	if err := client.NodeDelete(ctx, runtime, &types.Node{Name: nodeID}, types.NodeDeleteOpts{}); err != nil {
 		return diag.FromErr(err)
 	}
 
 	return nil
 }
+
+// getNode returns the node running in the container named nodeID, nil if there
+// is no such container.
+func getNode(ctx context.Context, runtime runtimes.Runtime, nodeID string) (*types.Node, error) {
+	nodes, err := client.NodeList(ctx, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if node.Name == nodeID {
+			return node, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// setDefaultK3sImage sets image to the latest stable k3s release, unless
+// configured. It is looked up on creation only, so that plans work offline
+// and the nodes aren't replaced along with the k3s releases.
+func setDefaultK3sImage(d *schema.ResourceData) error {
+	if d.Get("image").(string) != "" {
+		return nil
+	}
+
+	k3sVersion, err := version.GetK3sVersion("stable")
+	if err != nil {
+		return fmt.Errorf("failed to look up the latest stable k3s release: %w", err)
+	}
+
+	return d.Set("image", fmt.Sprintf("%s:%s", types.DefaultK3sImageRepo, k3sVersion))
+}
+
+// getNodeImage returns the image reference the node was created from, which
+// runtimes may report as an image ID instead.
+func getNodeImage(ctx context.Context, runtime runtimes.Runtime, node *types.Node) (string, error) {
+	if r, ok := asProviderRuntime(runtime); ok {
+		return r.GetNodeImage(ctx, node)
+	}
+
+	return node.Image, nil
+}
+
+// expandNode builds the spec of a node to add to a cluster, see nodeSchema.
+func expandNode(d *schema.ResourceData, nodeID string) (*types.Node, error) {
+	var ports nat.PortMap
+	if v, ok := d.GetOk("port"); ok {
+		var err error
+		if ports, err = expandNodePorts(v.([]interface{})); err != nil {
+			return nil, err
+		}
+	}
+
+	k3sNodeLabels := expandStringMap(d.Get("k3s_node_labels").(map[string]interface{}))
+	k3sNodeLabels[types.LabelRole] = d.Get("role").(string)
+
+	runtimeLabels := expandStringMap(d.Get("runtime_labels").(map[string]interface{}))
+	runtimeLabels[types.LabelRole] = d.Get("role").(string)
+
+	return &types.Node{
+		Name:          nodeID,
+		Role:          types.NodeRoles[d.Get("role").(string)],
+		Image:         d.Get("image").(string),
+		Args:          expandStringList(d.Get("k3s_extra_args").([]interface{})),
+		K3sNodeLabels: k3sNodeLabels,
+		RuntimeLabels: runtimeLabels,
+		Networks:      expandStringList(d.Get("networks").([]interface{})),
+		Ports:         ports,
+		Restart:       d.Get("restart_policy").(string) != "no",
+		Memory:        d.Get("memory").(string),
+		Env:           expandNodeEnv(d.Get("env").([]interface{})),
+		Volumes:       expandNodeVolumes(d.Get("volume").([]interface{})),
+	}, nil
+}
+
+// addNodesToCluster adds the nodes to the cluster with
+// client.NodeAddToClusterMulti, each based on an existing node of the cluster,
+// joining with the current token of the cluster. k3d gives the nodes the env
+// of that node and keeps its settings wherever the nodes leave theirs to the
+// zero value, so the nodes it didn't create as specified are replaced right
+// away.
+func addNodesToCluster(ctx context.Context, runtime runtimes.Runtime, clusterName string, nodes []*types.Node) error {
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+	if err != nil {
+		return fmt.Errorf("failed to find cluster '%s': %w", clusterName, err)
+	}
+
+	// the existing nodes may carry a token that has been rotated since
+	token, err := getClusterToken(ctx, runtime, cluster)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := addedNodeHooks(runtime, cluster, token)
+	if err != nil {
+		return err
+	}
+
+	// k3d modifies the nodes it is given
+	templates := make([]*types.Node, 0, len(nodes))
+	for _, node := range nodes {
+		template := *node
+		if template.Role == types.ServerRole {
+			template.Args = withoutServerInitFlags(template.Args)
+		}
+		templates = append(templates, &template)
+	}
+
+	// k3d appends its own hooks to the shared ones in parallel, the clipped
+	// slice makes each append copy it
+	if err := client.NodeAddToClusterMulti(ctx, runtime, templates, cluster, types.NodeCreateOpts{
+		Wait:         true,
+		ClusterToken: token,
+		NodeHooks:    slices.Clip(hooks),
+	}); err != nil {
+		return err
+	}
+
+	var envInfo *types.EnvironmentInfo
+	for _, node := range nodes {
+		added, err := client.NodeGet(ctx, runtime, &types.Node{Name: node.Name})
+		if err != nil {
+			return err
+		}
+
+		spec, err := fixedClusterNode(ctx, runtime, node, added)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		if err := setNodeToken(runtime, spec, token); err != nil {
+			return err
+		}
+
+		if envInfo == nil {
+			if envInfo, err = client.GatherEnvironmentInfo(ctx, runtime, cluster); err != nil {
+				return fmt.Errorf("failed to gather environment info of cluster '%s': %w", clusterName, err)
+			}
+		}
+		hooks, err := copyNodeHooks(ctx, runtime, added, envInfo)
+		if err != nil {
+			return err
+		}
+		spec.HookActions = append(spec.HookActions, hooks...)
+
+		tflog.Debug(ctx, "Replacing node with the settings k3d didn't apply", map[string]interface{}{"node": node.Name})
+		if err := replaceNode(ctx, runtime, added, spec, envInfo, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addedNodeHooks returns the hooks of the nodes added to the cluster besides
+// the ones k3d adds: writing the token config drop-in and injecting the host
+// aliases of the cluster.
+func addedNodeHooks(runtime runtimes.Runtime, cluster *types.Cluster, token string) ([]types.NodeHook, error) {
+	config, err := tokenConfig(token)
+	if err != nil {
+		return nil, err
+	}
+	hooks := []types.NodeHook{{
+		Stage: types.LifecycleStagePreStart,
+		Action: actions.WriteFileAction{
+			Runtime:     runtime,
+			Content:     config,
+			Dest:        k3sTokenConfigPath,
+			Mode:        0600,
+			Description: "Write cluster token",
+		},
+	}}
+
+	for _, node := range cluster.Nodes {
+		if node.Role != types.ServerRole && node.Role != types.AgentRole {
+			continue
+		}
+		hook, err := hostAliasesHook(runtime, node)
+		if err != nil || hook == nil {
+			return hooks, err
+		}
+		return append(hooks, *hook), nil
+	}
+
+	return hooks, nil
+}
+
+// fixedClusterNode returns the spec of the node replacing added, which k3d
+// created for node, with the settings k3d didn't apply: the env, a disabled
+// restart policy, the memory limit and the node pool label. nil is returned
+// if added is as specified.
+func fixedClusterNode(ctx context.Context, runtime runtimes.Runtime, node *types.Node, added *types.Node) (*types.Node, error) {
+	labels, err := getNodeRuntimeLabels(ctx, runtime, added)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := client.CopyNode(ctx, added, client.CopyNodeOpts{})
+	if err != nil {
+		return nil, err
+	}
+	spec.RuntimeLabels = maps.Clone(labels)
+
+	fixed := false
+	for _, e := range node.Env {
+		if !slices.Contains(spec.Env, e) {
+			spec.Env = append(spec.Env, e)
+			fixed = true
+		}
+	}
+
+	if spec.Restart != node.Restart {
+		spec.Restart = node.Restart
+		fixed = true
+	}
+
+	if !memoryEqual(node.Memory, added.Memory) {
+		spec.Memory = node.Memory
+		// the fake meminfo is mounted again by k3d according to the memory limit
+		spec.Volumes = slices.DeleteFunc(spec.Volumes, isFakeMemoryVolume)
+		fixed = true
+	}
+
+	// k3d merges the labels of the node it is based on into the new node's
+	if pool := node.RuntimeLabels[labelNodePool]; spec.RuntimeLabels[labelNodePool] != pool {
+		if pool == "" {
+			delete(spec.RuntimeLabels, labelNodePool)
+		} else {
+			spec.RuntimeLabels[labelNodePool] = pool
+		}
+		fixed = true
+	}
+
+	if !fixed {
+		return nil, nil
+	}
+
+	return spec, nil
+}
+
+// removeFailedNodes deletes nodes that failed to be added to a cluster, as no
+// resource tracks them, and returns their logs as diagnostics.
+func removeFailedNodes(ctx context.Context, c *apiClient, nodes []*types.Node) diag.Diagnostics {
+	// the logs are gone along with the nodes
+	diags := nodeLogsDiagnostics(ctx, c, nodes)
+
+	for _, node := range nodes {
+		// the load balancer is only updated once all nodes are running
+		if err := client.NodeDelete(ctx, c.runtime, node, types.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Failed to delete node %s", node.Name),
+				Detail:   err.Error(),
+			})
+		}
+	}
+
+	return diags
+}
+
+// withoutServerInitFlags returns args without the flags that only the server
+// initializing the cluster may have.
+func withoutServerInitFlags(args []string) []string {
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !slices.Contains(types.DoNotCopyServerFlags, arg) {
+			out = append(out, arg)
+		}
+	}
+
+	return out
+}
+
+func expandNodeEnv(l []interface{}) []string {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	env := make([]string, 0, len(l))
+	for _, i := range l {
+		v := i.(map[string]interface{})
+		env = append(env, fmt.Sprintf("%s=%s", v["key"].(string), v["value"].(string)))
+	}
+
+	return env
+}
+
+func expandNodePorts(l []interface{}) (nat.PortMap, error) {
+	if len(l) == 0 || l[0] == nil {
+		return nil, nil
+	}
+
+	ports := nat.PortMap{}
+	for _, i := range l {
+		v := i.(map[string]interface{})
+
+		port, err := nat.NewPort(strings.ToLower(v["protocol"].(string)), fmt.Sprintf("%d", v["container_port"].(int)))
+		if err != nil {
+			return nil, err
+		}
+
+		binding := nat.PortBinding{
+			HostIP: v["host"].(string),
+		}
+		if hostPort := v["host_port"].(int); hostPort != 0 {
+			binding.HostPort = fmt.Sprintf("%d", hostPort)
+		}
+
+		ports[port] = append(ports[port], binding)
+	}
+
+	return ports, nil
+}
+
+func expandStringList(l []interface{}) []string {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	out := make([]string, 0, len(l))
+	for _, i := range l {
+		out = append(out, i.(string))
+	}
+
+	return out
+}
+
+func expandStringMap(m map[string]interface{}) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v.(string)
+	}
+
+	return out
+}
+
+func expandNodeVolumes(l []interface{}) []string {
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+
+	volumes := make([]string, 0, len(l))
+	for _, i := range l {
+		v := i.(map[string]interface{})
+
+		volume := fmt.Sprintf("%s", v["destination"].(string))
+		if v["source"].(string) != "" {
+			volume = fmt.Sprintf("%s:%s", v["source"].(string), v["destination"].(string))
+		}
+
+		volumes = append(volumes, volume)
+	}
+
+	return volumes
+}
@@ -0,0 +1,280 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// labelNodePool is the runtime label identifying the members of a node pool.
+const labelNodePool = "k3d.node.pool"
+
+func resourceNodePool() *schema.Resource {
+	nodeSchema := nodeSchema()
+	nodeSchema["name"] = &schema.Schema{
+		Description:      "Node pool name, also used as prefix of the node names, with or without the `k3d-` prefix.",
+		ForceNew:         true,
+		Required:         true,
+		Type:             schema.TypeString,
+		DiffSuppressFunc: suppressEquivalentContainerName,
+	}
+	nodeSchema["replicas"] = &schema.Schema{
+		Description:  "Number of nodes in the pool.",
+		Optional:     true,
+		Type:         schema.TypeInt,
+		Default:      1,
+		ValidateFunc: validation.IntAtLeast(0),
+	}
+	nodeSchema["nodes"] = &schema.Schema{
+		Description: "Names of the node containers in the pool.",
+		Computed:    true,
+		Type:        schema.TypeList,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Pool of identical containerized k3s nodes (k3s in docker).",
+
+		CreateContext: resourceNodePoolCreate,
+		ReadContext:   resourceNodePoolRead,
+		UpdateContext: resourceNodePoolUpdate,
+		DeleteContext: resourceNodePoolDelete,
+
+		CustomizeDiff: forceNewIfMemoryLimitToggled("memory"),
+
+		Schema: nodeSchema,
+	}
+}
+
+func resourceNodePoolCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	poolID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node_pool", poolID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	if err := setDefaultK3sImage(d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// the nodes added before a failure are tracked by the tainted pool
+	d.SetId(poolID)
+
+	if err := scaleNodePool(ctx, runtime, d, nil); err != nil {
+		return scaleNodePoolDiagnostics(ctx, meta.(*apiClient), d, nil, err)
+	}
+
+	return resourceNodePoolRead(ctx, d, meta)
+}
+
+func resourceNodePoolRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	poolID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node_pool", poolID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	clusterName := d.Get("cluster").(string)
+	members, err := getNodePoolMembers(ctx, runtime, clusterName, poolID)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// an empty pool is only expected when scaled to zero and its cluster exists
+	if len(members) == 0 {
+		if _, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName}); err != nil {
+			if !errors.Is(err, client.ClusterGetNoNodesFoundError) {
+				return diag.FromErr(err)
+			}
+			log.Printf("[WARN] Cluster %s of node pool %s not found, removing from state", clusterName, poolID)
+			d.SetId("")
+			return nil
+		}
+		if d.Get("replicas").(int) > 0 {
+			log.Printf("[WARN] Nodes of node pool %s not found, removing from state", poolID)
+			d.SetId("")
+			return nil
+		}
+	}
+
+	nodes := make([]string, 0, len(members))
+	for _, member := range members {
+		nodes = append(nodes, member.Name)
+	}
+
+	if err := d.Set("nodes", nodes); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("replicas", len(members)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceNodePoolUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	poolID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node_pool", poolID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	members, err := getNodePoolMembers(ctx, runtime, d.Get("cluster").(string), poolID)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange("memory") {
+		for _, member := range members {
+			if err := updateNodeMemory(ctx, runtime, member, d.Get("memory").(string)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if err := scaleNodePool(ctx, runtime, d, members); err != nil {
+		return scaleNodePoolDiagnostics(ctx, meta.(*apiClient), d, members, err)
+	}
+
+	return resourceNodePoolRead(ctx, d, meta)
+}
+
+func resourceNodePoolDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	poolID := containerName(d.Get("name").(string))
+	ctx = tflog.SetField(ctx, "node_pool", poolID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := meta.(*apiClient).runtime
+
+	members, err := getNodePoolMembers(ctx, runtime, d.Get("cluster").(string), poolID)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for _, member := range members {
+		if err := client.NodeDelete(ctx, runtime, member, types.NodeDeleteOpts{}); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return nil
+}
+
+// getNodePoolMembers returns the nodes carrying the pool label, ordered by
+// their index.
+func getNodePoolMembers(ctx context.Context, runtime runtimes.Runtime, clusterName string, poolID string) ([]*types.Node, error) {
+	members, err := runtime.GetNodesByLabel(ctx, map[string]string{
+		types.LabelClusterName: clusterName,
+		labelNodePool:          poolID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return nodePoolMemberIndex(members[i].Name) < nodePoolMemberIndex(members[j].Name)
+	})
+
+	return members, nil
+}
+
+// nodePoolMemberIndex extracts the index from a pool member name
+// (<pool container name>-<index>), -1 if there is none.
+func nodePoolMemberIndex(nodeName string) int {
+	i := strings.LastIndex(nodeName, "-")
+	if i < 0 {
+		return -1
+	}
+
+	index, err := strconv.Atoi(nodeName[i+1:])
+	if err != nil {
+		return -1
+	}
+
+	return index
+}
+
+// scaleNodePool creates or deletes nodes until the pool has the desired
+// number of replicas. New nodes fill the lowest free indices, nodes with the
+// highest indices are removed first.
+func scaleNodePool(ctx context.Context, runtime runtimes.Runtime, d *schema.ResourceData, members []*types.Node) error {
+	clusterName := d.Get("cluster").(string)
+	poolID := containerName(d.Get("name").(string))
+	replicas := d.Get("replicas").(int)
+
+	if len(members) > replicas {
+		for _, member := range members[replicas:] {
+			tflog.Debug(ctx, "Removing node from pool", map[string]interface{}{"node": member.Name})
+			if err := client.NodeDelete(ctx, runtime, member, types.NodeDeleteOpts{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	used := make(map[int]bool, len(members))
+	for _, member := range members {
+		used[nodePoolMemberIndex(member.Name)] = true
+	}
+
+	nodes := make([]*types.Node, 0, replicas-len(members))
+	nodeIDs := make([]string, 0, replicas-len(members))
+	for index := 0; len(nodes) < replicas-len(members); index++ {
+		if used[index] {
+			continue
+		}
+
+		nodeID := fmt.Sprintf("%s-%d", poolID, index)
+		node, err := expandNode(d, nodeID)
+		if err != nil {
+			return err
+		}
+		node.RuntimeLabels[labelNodePool] = poolID
+
+		nodes = append(nodes, node)
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	tflog.Debug(ctx, "Adding nodes to pool", map[string]interface{}{"nodes": nodeIDs})
+
+	return addNodesToCluster(ctx, runtime, clusterName, nodes)
+}
+
+// scaleNodePoolDiagnostics returns the diagnostics of scaleNodePool failing
+// with err, after removing the nodes it failed to add to the pool.
+func scaleNodePoolDiagnostics(ctx context.Context, c *apiClient, d *schema.ResourceData, members []*types.Node, err error) diag.Diagnostics {
+	existing := make(map[string]bool, len(members))
+	for _, member := range members {
+		existing[member.Name] = true
+	}
+
+	var added []*types.Node
+	for _, node := range failedNodes(ctx, c.runtime, map[string]string{
+		types.LabelClusterName: d.Get("cluster").(string),
+		labelNodePool:          containerName(d.Get("name").(string)),
+	}, err) {
+		if !existing[node.Name] {
+			added = append(added, node)
+		}
+	}
+
+	return append(diag.FromErr(err), removeFailedNodes(ctx, c, added)...)
+}
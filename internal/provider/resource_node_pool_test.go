@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestAccResourceNodePool(t *testing.T) {
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceNodePool(name, 2),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"k3d_node_pool.foo", "name", name),
+					resource.TestCheckResourceAttr(
+						"k3d_node_pool.foo", "nodes.#", "2"),
+				),
+			},
+			{
+				Config: testAccResourceNodePool(name, 1),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"k3d_node_pool.foo", "nodes.#", "1"),
+					resource.TestCheckResourceAttr(
+						"k3d_node_pool.foo", "nodes.0", containerName(name)+"-0"),
+				),
+			},
+		},
+	})
+}
+
+func testAccResourceNodePool(name string, replicas int) string {
+	return fmt.Sprintf(`
+resource "k3d_cluster" "foo" {
+  name = %[1]q
+}
+
+resource "k3d_node_pool" "foo" {
+  name     = %[1]q
+  cluster  = k3d_cluster.foo.name
+  replicas = %[2]d
+}
+`, name, replicas)
+}
+
+func TestScaleNodePoolDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	var members []*types.Node
+	for _, name := range []string{"k3d-pool-0", "k3d-pool-1", "k3d-pool-2"} {
+		node := &types.Node{Name: name, RuntimeLabels: map[string]string{
+			types.LabelClusterName: "foo",
+			labelNodePool:          "k3d-pool",
+		}}
+		if err := runtime.CreateNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		if name == "k3d-pool-0" {
+			// a stopped member, not added by the failed scaling
+			members = append(members, node)
+		}
+		if name == "k3d-pool-1" {
+			if err := runtime.StartNode(ctx, node); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	runtime.logs["k3d-pool-2"] = []string{"level=fatal"}
+
+	d := schema.TestResourceDataRaw(t, resourceNodePool().Schema, map[string]interface{}{"cluster": "foo", "name": "pool"})
+	diags := scaleNodePoolDiagnostics(ctx, testMeta(runtime).(*apiClient), d, members, errors.New("failed to run node 'k3d-pool-2'"))
+
+	if len(diags) != 2 || !diags.HasError() || diags[1].Summary != "Last logs of node k3d-pool-2" {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	for name, expected := range map[string]bool{"k3d-pool-0": true, "k3d-pool-1": true, "k3d-pool-2": false} {
+		if _, ok := runtime.nodes[name]; ok != expected {
+			t.Errorf("%s: expected the node to exist: %t", name, expected)
+		}
+	}
+}
+
+func TestResourceNodePoolRead_gone(t *testing.T) {
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		cluster  bool
+		replicas int
+		expected bool
+	}{
+		"cluster gone":   {cluster: false, replicas: 0, expected: false},
+		"members gone":   {cluster: true, replicas: 2, expected: false},
+		"scaled to zero": {cluster: true, replicas: 0, expected: true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			if c.cluster {
+				server := &types.Node{Name: "k3d-foo-server-0", Role: types.ServerRole, RuntimeLabels: map[string]string{
+					types.LabelClusterName: "foo",
+					types.LabelRole:        string(types.ServerRole),
+				}}
+				if err := runtime.CreateNode(ctx, server); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceNodePool().Schema, map[string]interface{}{"cluster": "foo", "name": "pool", "replicas": c.replicas})
+			d.SetId("k3d-pool")
+
+			if diags := resourceNodePoolRead(ctx, d, testMeta(runtime)); diags.HasError() {
+				t.Fatalf("unexpected error: %v", diags)
+			}
+			if kept := d.Id() != ""; kept != c.expected {
+				t.Errorf("expected the pool to be kept in state: %t", c.expected)
+			}
+		})
+	}
+}
@@ -1,37 +1,172 @@
 package provider
 
 import (
-	"regexp"
+	"context"
+	"fmt"
+	"reflect"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
 )
 
+func init() {
+	// deleting the clusters deletes their nodes, sweep what is left only
+	resource.AddTestSweepers("k3d_node", &resource.Sweeper{
+		Name:         "k3d_node",
+		Dependencies: []string{"k3d_cluster"},
+		F: func(_ string) error {
+			return sweepNodes(types.ServerRole, types.AgentRole)
+		},
+	})
+}
+
 func TestAccResourceNode(t *testing.T) {
 	//t.Skip("resource not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccResourceNode,
+				Config: testAccResourceNode(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"k3d_node.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"k3d_node.foo", "name", name),
 				),
 			},
+			{
+				ResourceName:      "k3d_node.foo",
+				ImportState:       true,
+				ImportStateId:     containerName(name),
+				ImportStateVerify: true,
+			},
 		},
 	})
 }
 
-const testAccResourceNode = `
+func testAccResourceNode(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_cluster" "foo" {
-  name = "bar"
+  name = %[1]q
 }
 
 resource "k3d_node" "foo" {
-  name    = "bar"
+  name    = %[1]q
   cluster = k3d_cluster.foo.name
 }
-`
+`, name)
+}
+
+func TestFixedClusterNode(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+
+	// as k3d added it, based on a member of pool k3d-bar
+	added := &types.Node{
+		Name:          "k3d-foo-server-1",
+		Role:          types.ServerRole,
+		Image:         "rancher/k3s:v1.30.2-k3s1",
+		Cmd:           []string{"server", "--tls-san", "0.0.0.0"},
+		Env:           []string{"K3S_TOKEN=old", "K3S_URL=https://k3d-foo-serverlb:6443"},
+		Volumes:       []string{"k3d-foo-images:/k3d/images", "/tmp/meminfo:" + util.MemInfoPath + ":ro"},
+		Memory:        "1g",
+		Restart:       true,
+		RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: "server", labelNodePool: "k3d-bar"},
+	}
+	if err := runtime.CreateNode(ctx, added); err != nil {
+		t.Fatal(err)
+	}
+
+	node := &types.Node{
+		Name:          "k3d-foo-server-1",
+		Role:          types.ServerRole,
+		Env:           []string{"FOO=bar"},
+		RuntimeLabels: map[string]string{types.LabelRole: "server"},
+	}
+
+	spec, err := fixedClusterNode(ctx, runtime, node, added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec == nil {
+		t.Fatal("expected the node to be replaced")
+	}
+
+	if spec.Restart || spec.Memory != "" {
+		t.Errorf("expected no restart and no memory limit, got %t and %q", spec.Restart, spec.Memory)
+	}
+	if expected := []string{"K3S_TOKEN=old", "K3S_URL=https://k3d-foo-serverlb:6443", "FOO=bar"}; !reflect.DeepEqual(spec.Env, expected) {
+		t.Errorf("expected env %v, got %v", expected, spec.Env)
+	}
+	if expected := []string{"k3d-foo-images:/k3d/images"}; !reflect.DeepEqual(spec.Volumes, expected) {
+		t.Errorf("expected volumes %v, got %v", expected, spec.Volumes)
+	}
+	if _, ok := spec.RuntimeLabels[labelNodePool]; ok {
+		t.Errorf("expected the pool label of the base node to be dropped, got %v", spec.RuntimeLabels)
+	}
+
+	// k3d applied everything
+	node.Env = nil
+	node.Restart = true
+	node.Memory = "1g"
+	node.RuntimeLabels[labelNodePool] = "k3d-bar"
+	if spec, err := fixedClusterNode(ctx, runtime, node, added); err != nil || spec != nil {
+		t.Errorf("expected no replacement, got %+v, %v", spec, err)
+	}
+}
+
+func TestResourceNode_fake(t *testing.T) {
+	testFakeClusterEnv(t)
+	runtime := newFakeRuntime()
+	meta := testMeta(runtime)
+	testApply(t, resourceCluster(), nil, testFakeClusterConfig("foo"), meta)
+
+	r := resourceNode()
+	config := map[string]interface{}{
+		"name":    "bar",
+		"cluster": "foo",
+		"image":   "rancher/k3s:v1.30.4-k3s1",
+		"memory":  "1g",
+	}
+
+	state := testApply(t, r, nil, config, meta)
+	if state.ID != "k3d-bar" {
+		t.Fatalf("unexpected ID %q", state.ID)
+	}
+	node := runtime.node("k3d-bar")
+	if node == nil || !node.State.Running {
+		t.Fatal("expected the node to be running")
+	}
+	if node.Role != types.AgentRole || node.RuntimeLabels[types.LabelClusterName] != "foo" {
+		t.Errorf("expected an agent of cluster foo, got %s of %q", node.Role, node.RuntimeLabels[types.LabelClusterName])
+	}
+	expected := map[string]string{"container_name": "k3d-bar", "role": "agent", "image": "rancher/k3s:v1.30.4-k3s1", "memory": "1g"}
+	for k, v := range expected {
+		if actual := state.Attributes[k]; actual != v {
+			t.Errorf("expected %s %q, got %q", k, v, actual)
+		}
+	}
+
+	config["memory"] = "2g"
+	state = testApply(t, r, state, config, meta)
+	if node := runtime.node("k3d-bar"); !memoryEqual("2g", node.Memory) || !node.State.Running {
+		t.Errorf("expected the node to be running with 2g, got %q (running: %t)", node.Memory, node.State.Running)
+	}
+	if actual := state.Attributes["memory"]; actual != "2g" {
+		t.Errorf("expected memory 2g, got %q", actual)
+	}
+
+	testDestroy(t, r, state, meta)
+	if runtime.node("k3d-bar") != nil {
+		t.Error("expected the node to be gone")
+	}
+	if runtime.node("k3d-foo-server-0") == nil {
+		t.Error("expected the cluster to be kept")
+	}
+}
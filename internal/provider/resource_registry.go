@@ -3,112 +3,203 @@ package provider
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strconv"
 
 	"github.com/docker/go-connections/nat"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 
 	"github.com/k3d-io/k3d/v5/cmd/util"
 	"github.com/k3d-io/k3d/v5/pkg/client"
-	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
-func resourceRegistry() *schema.Resource {
-	return &schema.Resource{
+var (
+	_ resource.ResourceWithConfigure    = &registryResource{}
+	_ resource.ResourceWithUpgradeState = &registryResource{}
+)
+
+func newRegistryResource() resource.Resource {
+	return &registryResource{}
+}
+
+type registryResource struct {
+	client *apiClient
+}
+
+type registryResourceModel struct {
+	ID             fwtypes.String        `tfsdk:"id"`
+	Name           fwtypes.String        `tfsdk:"name"`
+	ContainerName  fwtypes.String        `tfsdk:"container_name"`
+	Image          fwtypes.String        `tfsdk:"image"`
+	Network        fwtypes.String        `tfsdk:"network"`
+	Port           fwtypes.Object        `tfsdk:"port"`
+	ProxyRemoteURL fwtypes.String        `tfsdk:"proxy_remote_url"`
+	ProxyUsername  fwtypes.String        `tfsdk:"proxy_username"`
+	ProxyPassword  fwtypes.String        `tfsdk:"proxy_password"`
+	Volume         []registryVolumeModel `tfsdk:"volume"`
+}
+
+type registryPortModel struct {
+	Host     fwtypes.String `tfsdk:"host"`
+	HostIP   fwtypes.String `tfsdk:"host_ip"`
+	HostPort fwtypes.Int64  `tfsdk:"host_port"`
+}
+
+var registryPortAttrTypes = map[string]attr.Type{
+	"host":      fwtypes.StringType,
+	"host_ip":   fwtypes.StringType,
+	"host_port": fwtypes.Int64Type,
+}
+
+type registryVolumeModel struct {
+	Source      fwtypes.String `tfsdk:"source"`
+	Destination fwtypes.String `tfsdk:"destination"`
+}
+
+func (r *registryResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_registry"
+}
+
+func (r *registryResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
 		// This description is used by the documentation generator and the language server.
-		Description: "k3d-managed registry.",
-
-		CreateContext: resourceRegistryCreate,
-		ReadContext:   resourceRegistryRead,
-		// UpdateContext: resourceRegistryUpdate,
-		DeleteContext: resourceRegistryDelete,
-
-		Schema: map[string]*schema.Schema{
-			"name": {
-				Description: "Node name.",
-				ForceNew:    true,
-				Required:    true,
-				Type:        schema.TypeString,
+		MarkdownDescription: "k3d-managed registry.",
+
+		// version 1 turned the port block into an object
+		Version: 1,
+
+		Attributes: map[string]schema.Attribute{
+			"id": idAttribute(),
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Registry name, with or without the `k3d-` prefix.",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIf(requiresReplaceIfOtherContainer, "Changing the name replaces the registry, unless only the `k3d-` prefix is added or removed.", "Changing the name replaces the registry, unless only the `k3d-` prefix is added or removed."),
+				},
+			},
+			"container_name": schema.StringAttribute{
+				MarkdownDescription: "Name of the registry container.",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
-			"image": {
-				Description: "Node name.",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
-				Default:     fmt.Sprintf("%s:%s", types.DefaultRegistryImageRepo, types.DefaultRegistryImageTag),
+			"image": schema.StringAttribute{
+				MarkdownDescription: "Registry image.",
+				Computed:            true,
+				Optional:            true,
+				Default:             stringdefault.StaticString(fmt.Sprintf("%s:%s", types.DefaultRegistryImageRepo, types.DefaultRegistryImageTag)),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
-			"network": {
-				Description: "Join an existing network.",
-				Computed:    true,
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
+			"network": schema.StringAttribute{
+				MarkdownDescription: "Join an existing network.",
+				Computed:            true,
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIfConfigured(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
-			"port": {
-				Description: "Select which port the registry should be listening on on your machine (localhost).",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeList,
-				MaxItems:    1,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"host": {
-							ForceNew: true,
-							Optional: true,
-							Type:     schema.TypeString,
+			"port": schema.SingleNestedAttribute{
+				MarkdownDescription: "Select which port the registry should be listening on on your machine (localhost). By default, a free port is picked.",
+				Computed:            true,
+				Optional:            true,
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.UseStateForUnknown(),
+				},
+				Attributes: map[string]schema.Attribute{
+					"host": schema.StringAttribute{
+						MarkdownDescription: "Host name the registry is reachable at.",
+						Computed:            true,
+						Optional:            true,
+						PlanModifiers: []planmodifier.String{
+							stringplanmodifier.RequiresReplaceIfConfigured(),
+							stringplanmodifier.UseStateForUnknown(),
 						},
-						"host_ip": {
-							ForceNew:     true,
-							Optional:     true,
-							Type:         schema.TypeString,
-							ValidateFunc: validation.IsIPAddress,
+					},
+					"host_ip": schema.StringAttribute{
+						MarkdownDescription: "Host IP the registry port is bound to.",
+						Computed:            true,
+						Optional:            true,
+						PlanModifiers: []planmodifier.String{
+							stringplanmodifier.RequiresReplaceIfConfigured(),
+							stringplanmodifier.UseStateForUnknown(),
+						},
+						Validators: []validator.String{
+							ipAddressValidator{},
+						},
+					},
+					"host_port": schema.Int64Attribute{
+						MarkdownDescription: "Host port the registry port is bound to. By default, a free port is picked.",
+						Computed:            true,
+						Optional:            true,
+						PlanModifiers: []planmodifier.Int64{
+							int64planmodifier.RequiresReplaceIfConfigured(),
+							int64planmodifier.UseStateForUnknown(),
 						},
-						"host_port": {
-							ForceNew:     true,
-							Optional:     true,
-							Type:         schema.TypeInt,
-							ValidateFunc: validation.IsPortNumber,
+						Validators: []validator.Int64{
+							int64validator.Between(1, 65535),
 						},
 					},
 				},
 			},
-			"proxy_remote_url": {
-				Description:  "URL of the proxied remote registry",
-				ForceNew:     true,
-				Optional:     true,
-				Type:         schema.TypeString,
-				ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			"proxy_remote_url": schema.StringAttribute{
+				MarkdownDescription: "URL of the proxied remote registry",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					httpURLValidator{},
+				},
 			},
-			"proxy_username": {
-				Description: "Username of the proxied remote registry",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
+			"proxy_username": schema.StringAttribute{
+				MarkdownDescription: "Username of the proxied remote registry",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
-			"proxy_password": {
-				Description: "Password of the proxied remote registry",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeString,
+			"proxy_password": schema.StringAttribute{
+				MarkdownDescription: "Password of the proxied remote registry",
+				Optional:            true,
+				Sensitive:           true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
-			"volume": {
-				Description: "Mount volumes into the registry node",
-				ForceNew:    true,
-				Optional:    true,
-				Type:        schema.TypeList,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"source": {
-							ForceNew: true,
-							Optional: true,
-							Type:     schema.TypeString,
+			"volume": schema.ListNestedAttribute{
+				MarkdownDescription: "Mount volumes into the registry node",
+				Optional:            true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"source": schema.StringAttribute{
+							MarkdownDescription: "Host path or volume name, an anonymous volume is created otherwise.",
+							Optional:            true,
 						},
-						"destination": {
-							ForceNew: true,
-							Required: true,
-							Type:     schema.TypeString,
+						"destination": schema.StringAttribute{
+							MarkdownDescription: "Path in the registry node.",
+							Required:            true,
 						},
 					},
 				},
@@ -117,115 +208,290 @@ func resourceRegistry() *schema.Resource {
 	}
 }
 
-func resourceRegistryCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	registryName := d.Get("name").(string)
-	registryID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, registryName)
+// requiresReplaceIfOtherContainer replaces the object unless the new name
+// refers to the same container, e.g. "foo" and "k3d-foo".
+func requiresReplaceIfOtherContainer(ctx context.Context, req planmodifier.StringRequest, resp *stringplanmodifier.RequiresReplaceIfFuncResponse) {
+	resp.RequiresReplace = containerName(req.StateValue.ValueString()) != containerName(req.PlanValue.ValueString())
+}
+
+func (r *registryResource) UpgradeState(ctx context.Context) map[int64]resource.StateUpgrader {
+	return map[int64]resource.StateUpgrader{
+		// the SDK stored the port as a list of at most one block
+		0: {
+			PriorSchema: &schema.Schema{
+				Attributes: map[string]schema.Attribute{
+					"id":             schema.StringAttribute{Computed: true},
+					"name":           schema.StringAttribute{Required: true},
+					"container_name": schema.StringAttribute{Computed: true},
+					"image":          schema.StringAttribute{Optional: true},
+					"network":        schema.StringAttribute{Computed: true, Optional: true},
+					"port": schema.ListNestedAttribute{
+						Optional: true,
+						NestedObject: schema.NestedAttributeObject{
+							Attributes: map[string]schema.Attribute{
+								"host":      schema.StringAttribute{Optional: true},
+								"host_ip":   schema.StringAttribute{Optional: true},
+								"host_port": schema.Int64Attribute{Optional: true},
+							},
+						},
+					},
+					"proxy_remote_url": schema.StringAttribute{Optional: true},
+					"proxy_username":   schema.StringAttribute{Optional: true},
+					"proxy_password":   schema.StringAttribute{Optional: true},
+					"volume": schema.ListNestedAttribute{
+						Optional: true,
+						NestedObject: schema.NestedAttributeObject{
+							Attributes: map[string]schema.Attribute{
+								"source":      schema.StringAttribute{Optional: true},
+								"destination": schema.StringAttribute{Required: true},
+							},
+						},
+					},
+				},
+			},
+			StateUpgrader: upgradeRegistryStateV0,
+		},
+	}
+}
+
+// registryResourceModelV0 is the SDK state, with the port as a list.
+type registryResourceModelV0 struct {
+	ID             fwtypes.String        `tfsdk:"id"`
+	Name           fwtypes.String        `tfsdk:"name"`
+	ContainerName  fwtypes.String        `tfsdk:"container_name"`
+	Image          fwtypes.String        `tfsdk:"image"`
+	Network        fwtypes.String        `tfsdk:"network"`
+	Port           []registryPortModel   `tfsdk:"port"`
+	ProxyRemoteURL fwtypes.String        `tfsdk:"proxy_remote_url"`
+	ProxyUsername  fwtypes.String        `tfsdk:"proxy_username"`
+	ProxyPassword  fwtypes.String        `tfsdk:"proxy_password"`
+	Volume         []registryVolumeModel `tfsdk:"volume"`
+}
+
+func upgradeRegistryStateV0(ctx context.Context, req resource.UpgradeStateRequest, resp *resource.UpgradeStateResponse) {
+	var prior registryResourceModelV0
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	state := registryResourceModel{
+		ID:             prior.ID,
+		Name:           prior.Name,
+		ContainerName:  prior.ContainerName,
+		Image:          prior.Image,
+		Network:        prior.Network,
+		Port:           fwtypes.ObjectNull(registryPortAttrTypes),
+		ProxyRemoteURL: prior.ProxyRemoteURL,
+		ProxyUsername:  prior.ProxyUsername,
+		ProxyPassword:  prior.ProxyPassword,
+		Volume:         prior.Volume,
+	}
+	if len(prior.Port) > 0 {
+		port, diags := fwtypes.ObjectValueFrom(ctx, registryPortAttrTypes, prior.Port[0])
+		resp.Diagnostics.Append(diags...)
+		state.Port = port
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+func (r *registryResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	r.client = configureClient(req.ProviderData, &resp.Diagnostics)
+}
+
+func (r *registryResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan registryResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	registryID := containerName(plan.Name.ValueString())
+	ctx = tflog.SetField(ctx, "registry", registryID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := r.client.runtime
+
+	exposureOpts, diags := expandExposureOpts(ctx, plan.Port)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// k3d fails halfway through when the host port is taken, check it first
+	binding := exposureOpts.PortMapping.Binding
+	if err := checkHostPorts(ctx, runtime, []hostPort{{ip: binding.HostIP, port: binding.HostPort, proto: "tcp"}}); err != nil {
+		resp.Diagnostics.AddError("Failed to create registry", err.Error())
+		return
+	}
 
 	registry := &types.Registry{
-		ExposureOpts: expandExposureOpts(d.Get("port").([]interface{})),
+		ExposureOpts: exposureOpts,
 		Host:         registryID,
-		Image:        d.Get("image").(string),
-		Network:      d.Get("network").(string),
-		Volumes:      expandRegistryVolumes(d.Get("volume").([]interface{})),
+		Image:        plan.Image.ValueString(),
+		Network:      plan.Network.ValueString(),
+		Volumes:      expandRegistryVolumes(plan.Volume),
 
 		Options: types.RegistryOptions{
 			Proxy: types.RegistryProxy{
-				RemoteURL: d.Get("proxy_remote_url").(string),
-				Username:  d.Get("proxy_username").(string),
-				Password:  d.Get("proxy_password").(string),
+				RemoteURL: plan.ProxyRemoteURL.ValueString(),
+				Username:  plan.ProxyUsername.ValueString(),
+				Password:  plan.ProxyPassword.ValueString(),
 			},
 		},
 	}
 
-	if _, err := client.RegistryRun(ctx, runtimes.SelectedRuntime, registry); err != nil {
-		return diag.FromErr(err)
+	if _, err := client.RegistryRun(ctx, runtime, registry); err != nil {
+		resp.Diagnostics.AddError("Failed to create registry", err.Error())
+		return
 	}
 
-	d.SetId(registryID)
+	plan.ID = fwtypes.StringValue(registryID)
+	resp.Diagnostics.Append(r.read(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-	return resourceRegistryRead(ctx, d, meta)
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
 }
 
-func expandRegistryVolumes(l []interface{}) []string {
-	if len(l) == 0 || l[0] == nil {
-		return nil
+func (r *registryResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state registryResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	volumes := make([]string, 0, len(l))
-	for _, i := range l {
-		v := i.(map[string]interface{})
+	registryID := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "registry", registryID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
 
-		volume := fmt.Sprintf("%s", v["destination"].(string))
-		if v["source"].(string) != "" {
-			volume = fmt.Sprintf("%s:%s", v["source"].(string), v["destination"].(string))
-		}
+	registry, err := getNode(ctx, r.client.runtime, registryID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read registry", err.Error())
+		return
+	}
+	if registry == nil {
+		tflog.Warn(ctx, "Registry not found, removing from state")
+		resp.State.RemoveResource(ctx)
+		return
+	}
 
-		volumes = append(volumes, volume)
+	resp.Diagnostics.Append(r.read(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	return volumes
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
 }
 
-func resourceRegistryRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	registryName := d.Get("name").(string)
-	registryID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, registryName)
+// read sets the attributes k3d keeps track of in the registry node labels.
+func (r *registryResource) read(ctx context.Context, state *registryResourceModel) diag.Diagnostics {
+	var diags diag.Diagnostics
 
-	_, err := client.NodeGet(ctx, runtimes.SelectedRuntime, &types.Node{Name: registryID})
+	registry, err := client.NodeGet(ctx, r.client.runtime, &types.Node{Name: state.ID.ValueString()})
 	if err != nil {
-		return diag.FromErr(err)
+		diags.AddError("Failed to read registry", err.Error())
+		return diags
 	}
 
-	return nil
-}
+	state.ContainerName = fwtypes.StringValue(registry.Name)
+
+	// the registry joins the networks of the clusters using it as well
+	if network := state.Network.ValueString(); !slices.Contains(registry.Networks, network) && len(registry.Networks) > 0 {
+		state.Network = fwtypes.StringValue(registry.Networks[0])
+	}
 
-/*
-func resourceRegistryUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	// use the meta value to retrieve your client from the provider configure method
-	// client := meta.(*apiClient)
+	hostPort, _ := strconv.ParseInt(registry.RuntimeLabels[types.LabelRegistryPortExternal], 10, 64)
+	port, portDiags := fwtypes.ObjectValueFrom(ctx, registryPortAttrTypes, registryPortModel{
+		Host:     fwtypes.StringValue(registry.RuntimeLabels[types.LabelRegistryHost]),
+		HostIP:   fwtypes.StringValue(registry.RuntimeLabels[types.LabelRegistryHostIP]),
+		HostPort: fwtypes.Int64Value(hostPort),
+	})
+	diags.Append(portDiags...)
+	state.Port = port
 
-	return diag.Errorf("not implemented")
+	return diags
 }
-*/
 
-func resourceRegistryDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	registryName := d.Get("name").(string)
-	registryID := fmt.Sprintf("%s-%s", types.DefaultObjectNamePrefix, registryName)
+// Update only renames the registry between equivalent names, any other change
+// replaces it.
+func (r *registryResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan registryResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
 
-	if err := client.NodeDelete(ctx, runtimes.SelectedRuntime, &types.Node{Name: registryID}, types.NodeDeleteOpts{}); err != nil {
-		return diag.FromErr(err)
+func (r *registryResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state registryResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	return nil
+	registryID := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "registry", registryID)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+
+	if err := client.NodeDelete(ctx, r.client.runtime, &types.Node{Name: registryID}, types.NodeDeleteOpts{}); err != nil {
+		resp.Diagnostics.AddError("Failed to delete registry", err.Error())
+	}
 }
 
-func expandExposureOpts(l []interface{}) types.ExposureOpts {
-	freePort, _ := util.GetFreePort()
+func expandRegistryVolumes(l []registryVolumeModel) []string {
+	if len(l) == 0 {
+		return nil
+	}
 
-	if len(l) == 0 || l[0] == nil {
-		return types.ExposureOpts{
-			PortMapping: nat.PortMapping{
-				Port: types.DefaultRegistryPort,
-				Binding: nat.PortBinding{
-					HostPort: fmt.Sprintf("%d", freePort),
-				},
-			},
+	volumes := make([]string, 0, len(l))
+	for _, v := range l {
+		volume := v.Destination.ValueString()
+		if v.Source.ValueString() != "" {
+			volume = fmt.Sprintf("%s:%s", v.Source.ValueString(), v.Destination.ValueString())
 		}
+
+		volumes = append(volumes, volume)
 	}
 
-	v := l[0].(map[string]interface{})
+	return volumes
+}
 
-	hostPort := v["host_port"].(int)
+// expandExposureOpts binds the registry port to the configured host port, or
+// a free one.
+func expandExposureOpts(ctx context.Context, o fwtypes.Object) (types.ExposureOpts, diag.Diagnostics) {
+	var port registryPortModel
+	if !o.IsNull() && !o.IsUnknown() {
+		if diags := o.As(ctx, &port, basetypes.ObjectAsOptions{}); diags.HasError() {
+			return types.ExposureOpts{}, diags
+		}
+	}
+
+	hostPort := port.HostPort.ValueInt64()
 	if hostPort == 0 {
-		hostPort = freePort
+		freePort, err := util.GetFreePort()
+		if err != nil {
+			var diags diag.Diagnostics
+			diags.AddError("Failed to find a free port", err.Error())
+			return types.ExposureOpts{}, diags
+		}
+		hostPort = int64(freePort)
 	}
 
 	return types.ExposureOpts{
+		Host: port.Host.ValueString(),
 		PortMapping: nat.PortMapping{
 			Port: types.DefaultRegistryPort,
 			Binding: nat.PortBinding{
-				HostIP:   v["host_ip"].(string),
+				HostIP:   port.HostIP.ValueString(),
 				HostPort: fmt.Sprintf("%d", hostPort),
 			},
 		},
-	}
+	}, nil
 }
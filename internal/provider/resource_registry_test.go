@@ -1,32 +1,221 @@
 package provider
 
 import (
-	"regexp"
+	"context"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/docker/go-connections/nat"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
 )
 
+func init() {
+	resource.AddTestSweepers("k3d_registry", &resource.Sweeper{
+		Name: "k3d_registry",
+		F: func(_ string) error {
+			return sweepNodes(types.RegistryRole)
+		},
+	})
+}
+
 func TestAccResourceRegistry(t *testing.T) {
 	//t.Skip("resource not yet implemented, remove this once you add your own code")
 
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
 	resource.UnitTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: providerFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccResourceRegistry,
+				Config: testAccResourceRegistry(name),
 				Check: resource.ComposeTestCheckFunc(
-					resource.TestMatchResourceAttr(
-						"k3d_registry.foo", "name", regexp.MustCompile("^ba")),
+					resource.TestCheckResourceAttr(
+						"k3d_registry.foo", "name", name),
 				),
 			},
 		},
 	})
 }
 
-const testAccResourceRegistry = `
+func testAccResourceRegistry(name string) string {
+	return fmt.Sprintf(`
 resource "k3d_registry" "foo" {
-  name = "bar"
+  name = %[1]q
+}
+`, name)
+}
+
+func TestResourceRegistry_fakeRuntime(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	r, s := testResource(t, newRegistryResource, runtime)
+
+	if _, _, err := runtime.CreateNetworkIfNotPresent(ctx, &types.ClusterNetwork{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	portType := s.Type().TerraformType(ctx).(tftypes.Object).AttributeTypes["port"]
+	createResp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name":    tftypes.NewValue(tftypes.String, "bar"),
+		"image":   tftypes.NewValue(tftypes.String, "docker.io/library/registry:2"),
+		"network": tftypes.NewValue(tftypes.String, "foo"),
+		"port": tftypes.NewValue(portType, map[string]tftypes.Value{
+			"host":      tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"host_ip":   tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"host_port": tftypes.NewValue(tftypes.Number, 5000),
+		}),
+	})}, &createResp)
+	if createResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", createResp.Diagnostics)
+	}
+
+	var state registryResourceModel
+	createResp.State.Get(ctx, &state)
+	if id := state.ID.ValueString(); id != "k3d-bar" {
+		t.Errorf("expected ID k3d-bar, got %s", id)
+	}
+	if name := state.ContainerName.ValueString(); name != "k3d-bar" {
+		t.Errorf("expected container name k3d-bar, got %s", name)
+	}
+	if network := state.Network.ValueString(); network != "foo" {
+		t.Errorf("expected network foo, got %s", network)
+	}
+	var port registryPortModel
+	state.Port.As(ctx, &port, basetypes.ObjectAsOptions{})
+	if hostPort := port.HostPort.ValueInt64(); hostPort != 5000 {
+		t.Errorf("expected host port 5000, got %d", hostPort)
+	}
+
+	node := runtime.node("k3d-bar")
+	if node == nil {
+		t.Fatal("expected the registry node to be created")
+	}
+	if node.Role != types.RegistryRole {
+		t.Errorf("expected role %s, got %s", types.RegistryRole, node.Role)
+	}
+	if !node.State.Running {
+		t.Error("expected the registry node to be running")
+	}
+	if port := node.RuntimeLabels[types.LabelRegistryPortExternal]; port != "5000" {
+		t.Errorf("expected external port 5000, got %s", port)
+	}
+
+	readResp := fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", readResp.Diagnostics)
+	}
+	if readResp.State.Raw.IsNull() {
+		t.Error("expected the registry to stay in state")
+	}
+
+	deleteResp := fwresource.DeleteResponse{State: createResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: createResp.State}, &deleteResp)
+	if deleteResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", deleteResp.Diagnostics)
+	}
+	if runtime.node("k3d-bar") != nil {
+		t.Error("expected the registry node to be deleted")
+	}
+
+	// the registry is gone from the state once deleted
+	readResp = fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", readResp.Diagnostics)
+	}
+	if !readResp.State.Raw.IsNull() {
+		t.Error("expected the registry to be removed from state")
+	}
+}
+
+func TestResourceRegistry_hostPortTaken(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	r, s := testResource(t, newRegistryResource, runtime)
+
+	if err := runtime.CreateNode(ctx, &types.Node{
+		Name:          "k3d-baz",
+		RuntimeLabels: map[string]string{"app": "k3d"},
+		Ports:         nat.PortMap{"5000/tcp": {{HostIP: "0.0.0.0", HostPort: "5000"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	portType := s.Type().TerraformType(ctx).(tftypes.Object).AttributeTypes["port"]
+	createResp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name":  tftypes.NewValue(tftypes.String, "bar"),
+		"image": tftypes.NewValue(tftypes.String, "docker.io/library/registry:2"),
+		"port": tftypes.NewValue(portType, map[string]tftypes.Value{
+			"host":      tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"host_ip":   tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"host_port": tftypes.NewValue(tftypes.Number, 5000),
+		}),
+	})}, &createResp)
+	if !createResp.Diagnostics.HasError() {
+		t.Fatal("expected an error")
+	}
+	if detail := createResp.Diagnostics[0].Detail(); !strings.Contains(detail, "is already bound by k3d container k3d-baz") {
+		t.Errorf("unexpected error: %s", detail)
+	}
+	if runtime.node("k3d-bar") != nil {
+		t.Error("expected no registry node to be created")
+	}
+}
+
+func TestResourceRegistry_upgradeStateV0(t *testing.T) {
+	ctx := context.Background()
+	r, s := testResource(t, newRegistryResource, newFakeRuntime())
+
+	upgrader := r.(fwresource.ResourceWithUpgradeState).UpgradeState(ctx)[0]
+	priorType := upgrader.PriorSchema.Type().TerraformType(ctx).(tftypes.Object)
+	portType := priorType.AttributeTypes["port"].(tftypes.List).ElementType
+
+	prior := map[string]tftypes.Value{}
+	for name, attrType := range priorType.AttributeTypes {
+		prior[name] = tftypes.NewValue(attrType, nil)
+	}
+	prior["id"] = tftypes.NewValue(tftypes.String, "k3d-bar")
+	prior["name"] = tftypes.NewValue(tftypes.String, "bar")
+	prior["port"] = tftypes.NewValue(priorType.AttributeTypes["port"], []tftypes.Value{
+		tftypes.NewValue(portType, map[string]tftypes.Value{
+			"host":      tftypes.NewValue(tftypes.String, "registry.localhost"),
+			"host_ip":   tftypes.NewValue(tftypes.String, "127.0.0.1"),
+			"host_port": tftypes.NewValue(tftypes.Number, 5000),
+		}),
+	})
+
+	req := fwresource.UpgradeStateRequest{
+		State: &tfsdk.State{Schema: *upgrader.PriorSchema, Raw: tftypes.NewValue(priorType, prior)},
+	}
+	resp := fwresource.UpgradeStateResponse{State: testState(s)}
+	upgrader.StateUpgrader(ctx, req, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state registryResourceModel
+	resp.State.Get(ctx, &state)
+	var port registryPortModel
+	state.Port.As(ctx, &port, basetypes.ObjectAsOptions{})
+	if host := port.Host.ValueString(); host != "registry.localhost" {
+		t.Errorf("expected host registry.localhost, got %s", host)
+	}
+	if hostIP := port.HostIP.ValueString(); hostIP != "127.0.0.1" {
+		t.Errorf("expected host IP 127.0.0.1, got %s", hostIP)
+	}
+	if hostPort := port.HostPort.ValueInt64(); hostPort != 5000 {
+		t.Errorf("expected host port 5000, got %d", hostPort)
+	}
 }
-`
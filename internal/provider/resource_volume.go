@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+var (
+	_ resource.ResourceWithConfigure   = &volumeResource{}
+	_ resource.ResourceWithImportState = &volumeResource{}
+)
+
+func newVolumeResource() resource.Resource {
+	return &volumeResource{}
+}
+
+type volumeResource struct {
+	client *apiClient
+}
+
+type volumeResourceModel struct {
+	ID     fwtypes.String `tfsdk:"id"`
+	Name   fwtypes.String `tfsdk:"name"`
+	Labels fwtypes.Map    `tfsdk:"labels"`
+}
+
+func (r *volumeResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_volume"
+}
+
+func (r *volumeResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "k3d-managed named volume, to be mounted into nodes and registries through their `volume` blocks. It outlives the clusters using it.",
+
+		Attributes: map[string]schema.Attribute{
+			"id": idAttribute(),
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Volume name, to be used as `source` of `volume` blocks.",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"labels": schema.MapAttribute{
+				MarkdownDescription: "Labels of the volume, in addition to the k3d ones. Volumes labelled with a cluster are deleted along with it, so `" + types.LabelClusterName + "` is not allowed.",
+				ElementType:         fwtypes.StringType,
+				Optional:            true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.Map{
+					volumeLabelsValidator{},
+				},
+			},
+		},
+	}
+}
+
+// volumeLabelsValidator rejects the cluster label, which would have the volume
+// deleted along with the cluster.
+type volumeLabelsValidator struct{}
+
+func (v volumeLabelsValidator) Description(ctx context.Context) string {
+	return fmt.Sprintf("the %s label would have the volume deleted along with the cluster", types.LabelClusterName)
+}
+
+func (v volumeLabelsValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v volumeLabelsValidator) ValidateMap(ctx context.Context, req validator.MapRequest, resp *validator.MapResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, ok := req.ConfigValue.Elements()[types.LabelClusterName]; ok {
+		resp.Diagnostics.AddAttributeError(req.Path.AtMapKey(types.LabelClusterName), "Invalid volume label", v.Description(ctx))
+	}
+}
+
+func (r *volumeResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	r.client = configureClient(req.ProviderData, &resp.Diagnostics)
+}
+
+func (r *volumeResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan volumeResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	volumeName := plan.Name.ValueString()
+	ctx = tflog.SetField(ctx, "volume", volumeName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+	runtime := r.client.runtime
+
+	// creating a volume that exists already succeeds, don't adopt it silently
+	if _, err := runtime.GetVolume(volumeName); err == nil {
+		resp.Diagnostics.AddError("Failed to create volume", "A volume with that name already exists")
+		return
+	}
+
+	labels := map[string]string{}
+	if !plan.Labels.IsNull() {
+		resp.Diagnostics.Append(plan.Labels.ElementsAs(ctx, &labels, false)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	if err := runtime.CreateVolume(ctx, volumeName, labels); err != nil {
+		resp.Diagnostics.AddError("Failed to create volume", err.Error())
+		return
+	}
+
+	plan.ID = fwtypes.StringValue(volumeName)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
+
+func (r *volumeResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state volumeResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	volumeName := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "volume", volumeName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+
+	name, err := r.client.runtime.GetVolume(volumeName)
+	if errors.Is(err, runtimeErrors.ErrRuntimeVolumeNotExists) {
+		tflog.Warn(ctx, "Volume not found, removing from state")
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read volume", err.Error())
+		return
+	}
+
+	state.Name = fwtypes.StringValue(name)
+
+	// the runtime reports the labels only through the provider extension
+	if pr, ok := asProviderRuntime(r.client.runtime); ok {
+		labels, err := pr.GetVolumeLabels(ctx, volumeName)
+		if err != nil {
+			resp.Diagnostics.AddError("Failed to read volume", err.Error())
+			return
+		}
+		labels = withoutK3dLabels(labels)
+
+		// no labels are read back as configured, null or empty
+		if len(labels) > 0 || !state.Labels.IsNull() {
+			value, diags := fwtypes.MapValueFrom(ctx, fwtypes.StringType, labels)
+			resp.Diagnostics.Append(diags...)
+			if resp.Diagnostics.HasError() {
+				return
+			}
+			state.Labels = value
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+// withoutK3dLabels returns labels without those k3d puts on every volume.
+func withoutK3dLabels(labels map[string]string) map[string]string {
+	own := map[string]string{}
+	for k, v := range labels {
+		_, isDefault := types.DefaultRuntimeLabels[k]
+		_, isDefaultVar := types.DefaultRuntimeLabelsVar[k]
+		if !isDefault && !isDefaultVar {
+			own[k] = v
+		}
+	}
+
+	return own
+}
+
+// Update is never called: changing the name or the labels replaces the
+// volume.
+func (r *volumeResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	resp.Diagnostics.AddError("Failed to update volume", "Volumes can't be updated in place")
+}
+
+func (r *volumeResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state volumeResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	volumeName := state.ID.ValueString()
+	ctx = tflog.SetField(ctx, "volume", volumeName)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+
+	if err := r.client.runtime.DeleteVolume(ctx, volumeName); err != nil {
+		resp.Diagnostics.AddError("Failed to delete volume", err.Error())
+	}
+}
+
+func (r *volumeResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	fwtypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestAccResourceVolume(t *testing.T) {
+	name := acctest.RandomWithPrefix(testAccNamePrefix)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: protoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceVolume(name),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"k3d_volume.foo", "name", name),
+					resource.TestCheckResourceAttr(
+						"k3d_registry.foo", "volume.0.source", name),
+				),
+			},
+			{
+				ResourceName:      "k3d_volume.foo",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func testAccResourceVolume(name string) string {
+	return fmt.Sprintf(`
+resource "k3d_volume" "foo" {
+  name = %[1]q
+
+  labels = {
+    team = "platform"
+  }
+}
+
+resource "k3d_registry" "foo" {
+  name = %[1]q
+
+  volume = [{
+    source      = k3d_volume.foo.name
+    destination = "/var/lib/registry"
+  }]
+}
+`, name)
+}
+
+func TestVolumeLabelsValidator(t *testing.T) {
+	ctx := context.Background()
+
+	validate := func(labels map[string]attr.Value) diag.Diagnostics {
+		req := validator.MapRequest{
+			Path:        path.Root("labels"),
+			ConfigValue: fwtypes.MapValueMust(fwtypes.StringType, labels),
+		}
+		var resp validator.MapResponse
+		volumeLabelsValidator{}.ValidateMap(ctx, req, &resp)
+
+		return resp.Diagnostics
+	}
+
+	if diags := validate(map[string]attr.Value{"foo": fwtypes.StringValue("bar")}); diags.HasError() {
+		t.Errorf("expected no errors, got %v", diags)
+	}
+
+	diags := validate(map[string]attr.Value{"k3d.cluster": fwtypes.StringValue("bar")})
+	if diags.ErrorsCount() != 1 {
+		t.Fatalf("expected an error for the cluster label, got %v", diags)
+	}
+	if d, ok := diags[0].(diag.DiagnosticWithPath); !ok || !d.Path().Equal(path.Root("labels").AtMapKey("k3d.cluster")) {
+		t.Errorf("expected the error at the cluster label, got %v", diags[0])
+	}
+}
+
+func TestResourceVolume_fakeRuntime(t *testing.T) {
+	ctx := context.Background()
+	runtime := newFakeRuntime()
+	r, s := testResource(t, newVolumeResource, runtime)
+
+	createResp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name": tftypes.NewValue(tftypes.String, "foo"),
+		"labels": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+			"foo": tftypes.NewValue(tftypes.String, "bar"),
+		}),
+	})}, &createResp)
+	if createResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", createResp.Diagnostics)
+	}
+
+	var state volumeResourceModel
+	createResp.State.Get(ctx, &state)
+	if id := state.ID.ValueString(); id != "foo" {
+		t.Errorf("expected ID foo, got %s", id)
+	}
+	if labels := runtime.volumes["foo"]; labels["foo"] != "bar" || labels["app"] != "k3d" {
+		t.Errorf("expected the volume to be labelled, got %v", labels)
+	}
+
+	// the labels are read back without the k3d ones, changes outside of
+	// terraform included
+	runtime.volumes["foo"]["foo"] = "baz"
+	readResp := fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", readResp.Diagnostics)
+	}
+	readResp.State.Get(ctx, &state)
+	var labels map[string]string
+	state.Labels.ElementsAs(ctx, &labels, false)
+	if len(labels) != 1 || labels["foo"] != "baz" {
+		t.Errorf("expected labels foo=baz, got %v", labels)
+	}
+
+	// the volume exists already
+	resp := fwresource.CreateResponse{State: testState(s)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, s, map[string]tftypes.Value{
+		"name": tftypes.NewValue(tftypes.String, "foo"),
+	})}, &resp)
+	if !resp.Diagnostics.HasError() {
+		t.Error("expected an error creating the volume twice")
+	}
+
+	deleteResp := fwresource.DeleteResponse{State: createResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: createResp.State}, &deleteResp)
+	if deleteResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", deleteResp.Diagnostics)
+	}
+
+	readResp = fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", readResp.Diagnostics)
+	}
+	if !readResp.State.Raw.IsNull() {
+		t.Error("expected the volume to be removed from state")
+	}
+}
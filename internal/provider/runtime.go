@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/netip"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3ddocker "github.com/k3d-io/k3d/v5/pkg/runtimes/docker"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// providerRuntime is a k3d runtime offering what the provider needs beyond
+// the k3d runtime interface.
+type providerRuntime interface {
+	runtimes.Runtime
+
+	// GetNodeImage returns the image reference the node was created from.
+	GetNodeImage(ctx context.Context, node *types.Node) (string, error)
+	// GetNodeRuntimeLabels returns all the runtime labels of the node.
+	GetNodeRuntimeLabels(ctx context.Context, node *types.Node) (map[string]string, error)
+	// GetAllNodeLogs returns all the logs of the node, stopped or not.
+	GetAllNodeLogs(ctx context.Context, node *types.Node) (string, error)
+	// UpdateNodeMemory changes the memory limit of the node, in bytes.
+	UpdateNodeMemory(ctx context.Context, node *types.Node, memory int64) error
+	// ImageHasDirectory tells whether dir exists in image.
+	ImageHasDirectory(ctx context.Context, image string, dir string) (bool, error)
+	// CreateNetworkWithGateway creates network, unless present, with the
+	// subnet of its IPAM and gateway, instead of the first host address.
+	CreateNetworkWithGateway(ctx context.Context, network *types.ClusterNetwork, gateway netip.Addr) (*types.ClusterNetwork, bool, error)
+	// GetVolumeLabels returns all the labels of the named volume.
+	GetVolumeLabels(ctx context.Context, name string) (map[string]string, error)
+}
+
+// asProviderRuntime returns runtime as a providerRuntime, the docker runtime
+// of k3d being completed by the docker client. The runtime itself is kept
+// as is for k3d, which tells the docker runtime by identity. The helpers
+// fall back to what k3d reports for the other runtimes.
+func asProviderRuntime(runtime runtimes.Runtime) (providerRuntime, bool) {
+	if r, ok := runtime.(providerRuntime); ok {
+		return r, true
+	}
+	if runtime == runtimes.Docker {
+		return dockerRuntime{runtime}, true
+	}
+
+	return nil, false
+}
+
+// dockerRuntime is the docker runtime of k3d, inspecting the containers for
+// what it doesn't report.
+type dockerRuntime struct {
+	runtimes.Runtime
+}
+
+var _ providerRuntime = dockerRuntime{}
+
+// GetNodeImage implements providerRuntime. The docker runtime reports the
+// image ID, the reference is in the container config.
+func (r dockerRuntime) GetNodeImage(ctx context.Context, node *types.Node) (string, error) {
+	container, err := inspectContainer(ctx, node.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return container.Config.Image, nil
+}
+
+// GetNodeRuntimeLabels implements providerRuntime. The docker runtime only
+// reports the k3d labels.
+func (r dockerRuntime) GetNodeRuntimeLabels(ctx context.Context, node *types.Node) (map[string]string, error) {
+	container, err := inspectContainer(ctx, node.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.Config.Labels, nil
+}
+
+// GetAllNodeLogs implements providerRuntime. The docker runtime only serves
+// the logs of running containers.
+func (r dockerRuntime) GetAllNodeLogs(ctx context.Context, node *types.Node) (string, error) {
+	docker, err := k3ddocker.GetDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer docker.Close()
+
+	container, err := docker.ContainerInspect(ctx, node.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return containerLogs(ctx, docker, container.ID, container.Config.Tty, "all")
+}
+
+// UpdateNodeMemory implements providerRuntime.
+func (r dockerRuntime) UpdateNodeMemory(ctx context.Context, node *types.Node, memory int64) error {
+	docker, err := k3ddocker.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	// no swap on top of the limit, which is what the fake meminfo reports
+	// (SwapTotal: 0). Docker requires the swap limit along with the memory
+	// limit whenever the latter grows past the former.
+	if _, err := docker.ContainerUpdate(ctx, node.Name, container.UpdateConfig{
+		Resources: container.Resources{
+			Memory:     memory,
+			MemorySwap: memory,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to update memory limit of node '%s': %w", node.Name, err)
+	}
+
+	return nil
+}
+
+// ImageHasDirectory implements providerRuntime.
+func (r dockerRuntime) ImageHasDirectory(ctx context.Context, image string, dir string) (bool, error) {
+	return k3ddocker.CheckIfDirectoryExists(ctx, image, dir)
+}
+
+// CreateNetworkWithGateway implements providerRuntime, creating the network
+// as the docker runtime does, but for the gateway.
+func (r dockerRuntime) CreateNetworkWithGateway(ctx context.Context, inNet *types.ClusterNetwork, gateway netip.Addr) (*types.ClusterNetwork, bool, error) {
+	existing, err := r.GetNetwork(ctx, inNet)
+	if err == nil {
+		return existing, true, nil
+	}
+	if !errors.Is(err, runtimeErrors.ErrRuntimeNetworkNotExists) {
+		return nil, false, fmt.Errorf("failed to check for an existing network: %w", err)
+	}
+
+	docker, err := k3ddocker.GetDockerClient()
+	if err != nil {
+		return nil, false, err
+	}
+	defer docker.Close()
+
+	created, err := docker.NetworkCreate(ctx, inNet.Name, network.CreateOptions{
+		Driver: "bridge",
+		Options: map[string]string{
+			"com.docker.network.bridge.enable_ip_masquerade": "true",
+		},
+		Labels: maps.Clone(types.DefaultRuntimeLabels),
+		IPAM: &network.IPAM{
+			Config: []network.IPAMConfig{{
+				Subnet:  inNet.IPAM.IPPrefix.String(),
+				Gateway: gateway.String(),
+			}},
+		},
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("docker failed to create network '%s': %w", inNet.Name, err)
+	}
+
+	return &types.ClusterNetwork{
+		Name: inNet.Name,
+		ID:   created.ID,
+		IPAM: types.IPAM{IPPrefix: inNet.IPAM.IPPrefix, IPsUsed: []netip.Addr{gateway}, Managed: true},
+	}, false, nil
+}
+
+// GetVolumeLabels implements providerRuntime.
+func (r dockerRuntime) GetVolumeLabels(ctx context.Context, name string) (map[string]string, error) {
+	docker, err := k3ddocker.GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer docker.Close()
+
+	vol, err := docker.VolumeInspect(ctx, name)
+	if dockerclient.IsErrNotFound(err) {
+		return nil, fmt.Errorf("failed to find named volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("docker failed to inspect volume '%s': %w", name, err)
+	}
+
+	return vol.Labels, nil
+}
+
+// inspectContainer returns the details of the named container.
+func inspectContainer(ctx context.Context, name string) (dockertypes.ContainerJSON, error) {
+	docker, err := k3ddocker.GetDockerClient()
+	if err != nil {
+		return dockertypes.ContainerJSON{}, err
+	}
+	defer docker.Close()
+
+	return docker.ContainerInspect(ctx, name)
+}
+
+// containerLogs returns the last tail lines logged by the container, or all
+// of them if tail is "all". Unlike the runtime, it serves the logs of stopped
+// containers too.
+func containerLogs(ctx context.Context, docker dockerclient.APIClient, containerID string, tty bool, tail string) (string, error) {
+	reader, err := docker.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: tail})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var logs bytes.Buffer
+	if tty {
+		_, err = io.Copy(&logs, reader)
+	} else {
+		_, err = stdcopy.StdCopy(&logs, &logs, reader)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return logs.String(), nil
+}
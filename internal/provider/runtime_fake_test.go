@@ -0,0 +1,760 @@
+package provider
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-units"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	fwschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/types/fixes"
+)
+
+// fakeRuntime is an in-memory runtimes.Runtime, recording the containers,
+// networks and volumes k3d would create, so that resources can be tested
+// without docker.
+type fakeRuntime struct {
+	mu sync.Mutex
+
+	nodes    map[string]*types.Node
+	networks map[string]*types.ClusterNetwork
+	volumes  map[string]map[string]string
+	files    map[string]map[string][]byte
+	logs     map[string][]string
+	execs    map[string][][]string
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		nodes:    map[string]*types.Node{},
+		networks: map[string]*types.ClusterNetwork{},
+		volumes:  map[string]map[string]string{},
+		files:    map[string]map[string][]byte{},
+		logs:     map[string][]string{},
+		execs:    map[string][][]string{},
+	}
+}
+
+// testMeta returns the provider meta for resource functions using runtime.
+func testMeta(runtime *fakeRuntime) interface{} {
+	return &apiClient{runtime: runtime}
+}
+
+// testResource returns the framework resource built by newResource,
+// configured with runtime, and its schema.
+func testResource(t *testing.T, newResource func() fwresource.Resource, runtime *fakeRuntime) (fwresource.Resource, fwschema.Schema) {
+	t.Helper()
+
+	ctx := context.Background()
+	r := newResource()
+
+	var schemaResp fwresource.SchemaResponse
+	r.Schema(ctx, fwresource.SchemaRequest{}, &schemaResp)
+	if schemaResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", schemaResp.Diagnostics)
+	}
+
+	var configureResp fwresource.ConfigureResponse
+	r.(fwresource.ResourceWithConfigure).Configure(ctx, fwresource.ConfigureRequest{ProviderData: testMeta(runtime)}, &configureResp)
+	if configureResp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", configureResp.Diagnostics)
+	}
+
+	return r, schemaResp.Schema
+}
+
+// testPlan returns the plan of a resource of schema s configured with raw,
+// the attributes left out being unknown if computed and null otherwise.
+func testPlan(t *testing.T, s fwschema.Schema, raw map[string]tftypes.Value) tfsdk.Plan {
+	t.Helper()
+
+	typ := s.Type().TerraformType(context.Background()).(tftypes.Object)
+
+	values := map[string]tftypes.Value{}
+	for name, attrType := range typ.AttributeTypes {
+		switch v, ok := raw[name]; {
+		case ok:
+			values[name] = v
+		case s.Attributes[name].IsComputed():
+			values[name] = tftypes.NewValue(attrType, tftypes.UnknownValue)
+		default:
+			values[name] = tftypes.NewValue(attrType, nil)
+		}
+	}
+
+	return tfsdk.Plan{Schema: s, Raw: tftypes.NewValue(typ, values)}
+}
+
+// testState returns the empty state of a resource of schema s.
+func testState(s fwschema.Schema) tfsdk.State {
+	return tfsdk.State{Schema: s, Raw: tftypes.NewValue(s.Type().TerraformType(context.Background()), nil)}
+}
+
+// testFakeClusterEnv prepares the environment for k3d to create clusters in
+// the fake runtime: the DNS fix needs the host gateway only the docker runtime
+// finds, and the default kubeconfig and k3d files are kept in temporary
+// directories.
+func testFakeClusterEnv(t *testing.T) {
+	t.Setenv(types.K3dEnvFixDNS, "false")
+	fixes.EnabledFixes = nil
+	t.Cleanup(func() { fixes.EnabledFixes = nil })
+
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+// testFakeClusterConfig returns the configuration of a k3d_cluster the fake
+// runtime can create: a single server on the host network, as k3d gathers
+// the host gateway of the other networks from docker only.
+func testFakeClusterConfig(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    name,
+		"image":   "rancher/k3s:v1.30.4-k3s1",
+		"network": "host",
+		"k3d":     []interface{}{map[string]interface{}{"disable_load_balancer": true}},
+	}
+}
+
+// testApply plans raw, the configuration of r, against state and applies the
+// plan, as terraform does, returning the new state.
+func testApply(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) *terraform.InstanceState {
+	t.Helper()
+	ctx := context.Background()
+
+	diff, err := r.Diff(ctx, state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, diags := r.Apply(ctx, state, diff, meta)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	return state
+}
+
+// testDestroy destroys state, as terraform does.
+func testDestroy(t *testing.T, r *schema.Resource, state *terraform.InstanceState, meta interface{}) {
+	t.Helper()
+
+	if _, diags := r.Apply(context.Background(), state, &terraform.InstanceDiff{Destroy: true}, meta); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+}
+
+func (f *fakeRuntime) ID() string {
+	return "fake"
+}
+
+func (f *fakeRuntime) GetHost() string {
+	return ""
+}
+
+func (f *fakeRuntime) CreateNode(_ context.Context, node *types.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[node.Name]; ok {
+		return fmt.Errorf("container '%s' already exists", node.Name)
+	}
+
+	for _, name := range node.Networks {
+		if _, ok := f.networks[name]; !ok && name != "bridge" && name != "host" {
+			return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeNetworkNotExists, name)
+		}
+	}
+
+	f.nodes[node.Name] = cloneNode(node)
+
+	return nil
+}
+
+func (f *fakeRuntime) DeleteNode(_ context.Context, node *types.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[node.Name]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	delete(f.nodes, node.Name)
+	delete(f.files, node.Name)
+	delete(f.logs, node.Name)
+
+	return nil
+}
+
+func (f *fakeRuntime) RenameNode(_ context.Context, node *types.Node, newName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+	if _, ok := f.nodes[newName]; ok {
+		return fmt.Errorf("container '%s' already exists", newName)
+	}
+
+	delete(f.nodes, node.Name)
+	existing.Name = newName
+	f.nodes[newName] = existing
+	f.files[newName], f.logs[newName] = f.files[node.Name], f.logs[node.Name]
+	delete(f.files, node.Name)
+	delete(f.logs, node.Name)
+
+	return nil
+}
+
+func (f *fakeRuntime) GetNodesByLabel(_ context.Context, labels map[string]string) ([]*types.Node, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	nodes := []*types.Node{}
+	for _, node := range f.nodes {
+		matches := true
+		for k, v := range labels {
+			if node.RuntimeLabels[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			nodes = append(nodes, cloneNode(node))
+		}
+	}
+
+	return nodes, nil
+}
+
+func (f *fakeRuntime) GetNode(_ context.Context, node *types.Node) (*types.Node, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// like the docker runtime, return the node along with the error, which
+	// client.NodeGet relies on
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return node, fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	return cloneNode(existing), nil
+}
+
+func (f *fakeRuntime) GetNodeStatus(_ context.Context, node *types.Node) (bool, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return false, "", fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	return existing.State.Running, existing.State.Status, nil
+}
+
+func (f *fakeRuntime) GetNodesInNetwork(_ context.Context, network string) ([]*types.Node, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	nodes := []*types.Node{}
+	for _, node := range f.nodes {
+		for _, name := range node.Networks {
+			if name == network {
+				nodes = append(nodes, cloneNode(node))
+			}
+		}
+	}
+
+	return nodes, nil
+}
+
+func (f *fakeRuntime) CreateNetworkIfNotPresent(_ context.Context, network *types.ClusterNetwork) (*types.ClusterNetwork, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, ok := f.networks[network.Name]; ok {
+		return existing, true, nil
+	}
+
+	created := *network
+	created.ID = fmt.Sprintf("fake-network-%d", len(f.networks))
+	if !created.IPAM.IPPrefix.IsValid() {
+		created.IPAM.IPPrefix = netip.MustParsePrefix(fmt.Sprintf("172.%d.0.0/16", 18+len(f.networks)))
+	}
+	// like docker, the gateway takes the first address of the subnet
+	created.IPAM.IPsUsed = []netip.Addr{created.IPAM.IPPrefix.Addr().Next()}
+	f.networks[created.Name] = &created
+
+	return &created, false, nil
+}
+
+func (f *fakeRuntime) CreateNetworkWithGateway(ctx context.Context, network *types.ClusterNetwork, gateway netip.Addr) (*types.ClusterNetwork, bool, error) {
+	created, exists, err := f.CreateNetworkIfNotPresent(ctx, network)
+	if err != nil || exists {
+		return created, exists, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	created.IPAM.IPsUsed = []netip.Addr{gateway}
+
+	return created, false, nil
+}
+
+func (f *fakeRuntime) GetKubeconfig(ctx context.Context, node *types.Node) (io.ReadCloser, error) {
+	return f.ReadFromNode(ctx, "/output/kubeconfig.yaml", node)
+}
+
+func (f *fakeRuntime) DeleteNetwork(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.networks[name]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeNetworkNotExists, name)
+	}
+	for _, node := range f.nodes {
+		for _, network := range node.Networks {
+			if network == name {
+				return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeNetworkNotEmpty, name)
+			}
+		}
+	}
+
+	delete(f.networks, name)
+
+	return nil
+}
+
+func (f *fakeRuntime) StartNode(_ context.Context, node *types.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	existing.State.Running = true
+	existing.State.Status = "running"
+	existing.State.Started = time.Now().UTC().Format("2006-01-02T15:04:05.999999999Z")
+	node.State = existing.State
+
+	// like k3s, reset the cluster and exit
+	if slices.Contains(existing.Args, "--cluster-reset") {
+		existing.State.Running = false
+		existing.State.Status = "exited"
+		node.State = existing.State
+		f.logs[node.Name] = append(f.logs[node.Name], etcdResetLogMessage+", restart without --cluster-reset flag now.")
+		return nil
+	}
+
+	// log every message k3d may wait for, so that the node is ready at once
+	for _, message := range types.ReadyLogMessagesByRoleAndIntent[existing.Role] {
+		f.logs[node.Name] = append(f.logs[node.Name], message)
+	}
+
+	return nil
+}
+
+func (f *fakeRuntime) StopNode(_ context.Context, node *types.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	existing.State.Running = false
+	existing.State.Status = "exited"
+	node.State = existing.State
+
+	return nil
+}
+
+func (f *fakeRuntime) CreateVolume(_ context.Context, name string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volumeLabels := map[string]string{}
+	for k, v := range labels {
+		volumeLabels[k] = v
+	}
+	for k, v := range types.DefaultRuntimeLabels {
+		volumeLabels[k] = v
+	}
+	for k, v := range types.DefaultRuntimeLabelsVar {
+		volumeLabels[k] = v
+	}
+	f.volumes[name] = volumeLabels
+
+	return nil
+}
+
+func (f *fakeRuntime) DeleteVolume(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.volumes[name]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeVolumeNotExists, name)
+	}
+	for _, node := range f.nodes {
+		for _, volume := range node.Volumes {
+			if strings.HasPrefix(volume, name+":") {
+				return fmt.Errorf("volume '%s' is in use by node '%s'", name, node.Name)
+			}
+		}
+	}
+
+	delete(f.volumes, name)
+
+	return nil
+}
+
+func (f *fakeRuntime) GetVolume(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.volumes[name]; !ok {
+		return "", fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeVolumeNotExists, name)
+	}
+
+	return name, nil
+}
+
+func (f *fakeRuntime) GetVolumeLabels(_ context.Context, name string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	labels, ok := f.volumes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeVolumeNotExists, name)
+	}
+
+	return maps.Clone(labels), nil
+}
+
+func (f *fakeRuntime) GetVolumesByLabel(_ context.Context, labels map[string]string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volumes := []string{}
+	for name, volumeLabels := range f.volumes {
+		matches := true
+		for k, v := range labels {
+			if volumeLabels[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			volumes = append(volumes, name)
+		}
+	}
+
+	return volumes, nil
+}
+
+func (f *fakeRuntime) GetImageStream(_ context.Context, _ []string) (io.ReadCloser, error) {
+	return io.NopCloser(&bytes.Buffer{}), nil
+}
+
+func (f *fakeRuntime) GetRuntimePath() string {
+	return ""
+}
+
+func (f *fakeRuntime) ExecInNode(_ context.Context, node *types.Node, cmd []string) error {
+	// as the docker runtime does
+	l.Log().Debugf("Executing command '%+v' in node '%s'", cmd, node.Name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[node.Name]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+	f.execs[node.Name] = append(f.execs[node.Name], cmd)
+
+	return nil
+}
+
+func (f *fakeRuntime) ExecInNodeWithStdin(ctx context.Context, node *types.Node, cmd []string, _ io.ReadCloser) error {
+	return f.ExecInNode(ctx, node, cmd)
+}
+
+func (f *fakeRuntime) ExecInNodeGetLogs(ctx context.Context, node *types.Node, cmd []string) (*bufio.Reader, error) {
+	if err := f.ExecInNode(ctx, node, cmd); err != nil {
+		return nil, err
+	}
+
+	return bufio.NewReader(&bytes.Buffer{}), nil
+}
+
+func (f *fakeRuntime) GetNodeLogs(_ context.Context, node *types.Node, _ time.Time, _ *runtimeTypes.NodeLogsOpts) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[node.Name]; !ok {
+		return nil, fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	return io.NopCloser(strings.NewReader(strings.Join(f.logs[node.Name], "\n") + "\n")), nil
+}
+
+func (f *fakeRuntime) GetImages(_ context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+// CopyToNode copies the file src to dest, or the directory src into the
+// directory dest, like docker does.
+func (f *fakeRuntime) CopyToNode(ctx context.Context, src string, dest string, node *types.Node) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+
+		return f.WriteToNode(ctx, content, dest, 0644, node)
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(src), path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return f.WriteToNode(ctx, content, filepath.Join(dest, rel), 0644, node)
+	})
+}
+
+func (f *fakeRuntime) WriteToNode(_ context.Context, content []byte, dest string, _ os.FileMode, node *types.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[node.Name]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+	if f.files[node.Name] == nil {
+		f.files[node.Name] = map[string][]byte{}
+	}
+	f.files[node.Name][dest] = append([]byte{}, content...)
+
+	return nil
+}
+
+// ReadFromNode returns the file, or the files of the directory, as a tar
+// archive, like docker does.
+func (f *fakeRuntime) ReadFromNode(_ context.Context, path string, node *types.Node) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	write := func(name string, content []byte) error {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			return err
+		}
+		_, err := writer.Write(content)
+		return err
+	}
+
+	if content, ok := f.files[node.Name][path]; ok {
+		if err := write(filepath.Base(path), content); err != nil {
+			return nil, err
+		}
+	} else {
+		names := []string{}
+		for name := range f.files[node.Name] {
+			if strings.HasPrefix(name, path+"/") {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeFileNotFound, path)
+		}
+		sort.Strings(names)
+
+		if err := writer.WriteHeader(&tar.Header{Name: filepath.Base(path) + "/", Mode: 0700, Typeflag: tar.TypeDir}); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if err := write(filepath.Join(filepath.Base(path), strings.TrimPrefix(name, path+"/")), f.files[node.Name][name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(&archive), nil
+}
+
+func (f *fakeRuntime) GetHostIP(_ context.Context, _ string) (netip.Addr, error) {
+	return netip.MustParseAddr("172.17.0.1"), nil
+}
+
+func (f *fakeRuntime) ConnectNodeToNetwork(_ context.Context, node *types.Node, network string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+	if _, ok := f.networks[network]; !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeNetworkNotExists, network)
+	}
+	existing.Networks = append(existing.Networks, network)
+
+	return nil
+}
+
+func (f *fakeRuntime) DisconnectNodeFromNetwork(_ context.Context, node *types.Node, network string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+
+	networks := []string{}
+	for _, name := range existing.Networks {
+		if name != network {
+			networks = append(networks, name)
+		}
+	}
+	existing.Networks = networks
+
+	return nil
+}
+
+func (f *fakeRuntime) Info() (*runtimeTypes.RuntimeInfo, error) {
+	return &runtimeTypes.RuntimeInfo{
+		Name:          "fake",
+		OSType:        "linux",
+		CgroupVersion: "2",
+		CgroupDriver:  "systemd",
+	}, nil
+}
+
+func (f *fakeRuntime) GetNetwork(_ context.Context, network *types.ClusterNetwork) (*types.ClusterNetwork, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, existing := range f.networks {
+		if existing.Name == network.Name || (network.ID != "" && existing.ID == network.ID) {
+			found := *existing
+			return &found, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeNetworkNotExists, network.Name)
+}
+
+var _ providerRuntime = (*fakeRuntime)(nil)
+
+func (f *fakeRuntime) GetNodeImage(ctx context.Context, node *types.Node) (string, error) {
+	existing, err := f.GetNode(ctx, node)
+	if err != nil {
+		return "", err
+	}
+
+	return existing.Image, nil
+}
+
+func (f *fakeRuntime) GetNodeRuntimeLabels(ctx context.Context, node *types.Node) (map[string]string, error) {
+	existing, err := f.GetNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	return existing.RuntimeLabels, nil
+}
+
+func (f *fakeRuntime) GetAllNodeLogs(ctx context.Context, node *types.Node) (string, error) {
+	reader, err := f.GetNodeLogs(ctx, node, time.Time{}, &runtimeTypes.NodeLogsOpts{})
+	if err != nil {
+		return "", err
+	}
+
+	logs, err := io.ReadAll(reader)
+	return string(logs), err
+}
+
+func (f *fakeRuntime) UpdateNodeMemory(_ context.Context, node *types.Node, memory int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.nodes[node.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", runtimeErrors.ErrRuntimeContainerUnknown, node.Name)
+	}
+	existing.Memory = units.HumanSize(float64(memory))
+
+	return nil
+}
+
+func (f *fakeRuntime) ImageHasDirectory(_ context.Context, _ string, _ string) (bool, error) {
+	return false, nil
+}
+
+// node returns the node recorded under name, if any.
+func (f *fakeRuntime) node(name string) *types.Node {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if node, ok := f.nodes[name]; ok {
+		return cloneNode(node)
+	}
+
+	return nil
+}
+
+func cloneNode(node *types.Node) *types.Node {
+	clone := *node
+	clone.Networks = append([]string{}, node.Networks...)
+	clone.Volumes = append([]string{}, node.Volumes...)
+	clone.RuntimeLabels = map[string]string{}
+	for k, v := range node.RuntimeLabels {
+		clone.RuntimeLabels[k] = v
+	}
+
+	return &clone
+}
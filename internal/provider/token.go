@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/types/k3s"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// k3sTokenConfigPath is a k3s config drop-in holding the rotated token of the
+// cluster. The K3S_TOKEN env of existing containers can't be changed, but the
+// config file takes precedence over it when k3s restarts. It is also where
+// later nodes look up the token to join with. Nodes replacing or joining the
+// cluster get it written again, see setNodeToken.
+const k3sTokenConfigPath = "/etc/rancher/k3s/config.yaml.d/90-k3d-token.yaml"
+
+// rotateClusterToken rotates the server token of the cluster with k3s token
+// rotate and writes the new token into every k3s node. Both tokens are masked
+// in the logs, k3d logs the commands it executes.
+func rotateClusterToken(ctx context.Context, runtime runtimes.Runtime, clusterName string, oldToken string, newToken string) error {
+	ctx = maskK3dLogSecrets(ctx, oldToken, newToken)
+
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+	if err != nil {
+		return err
+	}
+
+	servers := util.FilterNodesByRole(cluster.Nodes, types.ServerRole)
+	if len(servers) == 0 {
+		return fmt.Errorf("no server found in cluster '%s'", clusterName)
+	}
+
+	cmd := []string{"k3s", "token", "rotate", "--token", oldToken, "--new-token", newToken}
+	if err := runtime.ExecInNode(ctx, servers[0], cmd); err != nil {
+		return fmt.Errorf("failed to rotate token in node '%s': %w", servers[0].Name, err)
+	}
+
+	config, err := tokenConfig(newToken)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range cluster.Nodes {
+		if node.Role != types.ServerRole && node.Role != types.AgentRole {
+			continue
+		}
+		if err := runtime.WriteToNode(ctx, config, k3sTokenConfigPath, 0600, node); err != nil {
+			return fmt.Errorf("failed to write token to node '%s': %w", node.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// getClusterToken returns the current token of the cluster, i.e. the rotated
+// one if any, falling back to the one k3d created the cluster with.
+func getClusterToken(ctx context.Context, runtime runtimes.Runtime, cluster *types.Cluster) (string, error) {
+	for _, node := range util.FilterNodesByRole(cluster.Nodes, types.ServerRole) {
+		content, err := readNodeFile(ctx, runtime, node, k3sTokenConfigPath)
+		if err != nil {
+			if errors.Is(err, runtimeErrors.ErrRuntimeFileNotFound) {
+				continue
+			}
+			return "", err
+		}
+
+		config := struct {
+			Token string `json:"token"`
+		}{}
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return "", fmt.Errorf("failed to read token of node '%s': %w", node.Name, err)
+		}
+		if config.Token != "" {
+			return config.Token, nil
+		}
+	}
+
+	return cluster.Token, nil
+}
+
+// setNodeToken makes node join with token, like k3d does for the token given
+// in the node create options: through the env and the label k3d reads the
+// token from when it recreates the node. The token config drop-in is written
+// into node as well, as the one written by rotateClusterToken is lost along
+// with the container node replaces or is based on.
+func setNodeToken(runtime runtimes.Runtime, node *types.Node, token string) error {
+	env := fmt.Sprintf("%s=%s", k3s.EnvClusterToken, token)
+	found := false
+	for i, e := range node.Env {
+		if strings.HasPrefix(e, k3s.EnvClusterToken+"=") {
+			node.Env[i] = env
+			found = true
+		}
+	}
+	if !found {
+		node.Env = append(node.Env, env)
+	}
+
+	if node.RuntimeLabels == nil {
+		node.RuntimeLabels = map[string]string{}
+	}
+	node.RuntimeLabels[types.LabelClusterToken] = token
+
+	config, err := tokenConfig(token)
+	if err != nil {
+		return err
+	}
+	node.HookActions = append(node.HookActions, types.NodeHook{
+		Stage: types.LifecycleStagePreStart,
+		Action: actions.WriteFileAction{
+			Runtime:     runtime,
+			Content:     config,
+			Dest:        k3sTokenConfigPath,
+			Mode:        0600,
+			Description: "Write cluster token",
+		},
+	})
+
+	return nil
+}
+
+func tokenConfig(token string) ([]byte, error) {
+	return yaml.Marshal(map[string]string{"token": token})
+}
+
+// readNodeFile returns the content of the file at path in the node.
+func readNodeFile(ctx context.Context, runtime runtimes.Runtime, node *types.Node, path string) ([]byte, error) {
+	reader, err := runtime.ReadFromNode(ctx, path, node)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// the content comes as a tar archive
+	archive := tar.NewReader(reader)
+	if _, err := archive.Next(); err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from node '%s': %w", path, node.Name, err)
+	}
+
+	content, err := io.ReadAll(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from node '%s': %w", path, node.Name, err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestSetNodeToken(t *testing.T) {
+	node := &types.Node{
+		Env:           []string{"K3S_URL=https://k3d-foo-server-0:6443", "K3S_TOKEN=old"},
+		RuntimeLabels: map[string]string{types.LabelClusterToken: "old"},
+	}
+
+	if err := setNodeToken(newFakeRuntime(), node, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEnv := []string{"K3S_URL=https://k3d-foo-server-0:6443", "K3S_TOKEN=new"}
+	if !reflect.DeepEqual(node.Env, expectedEnv) {
+		t.Errorf("expected env %v, got %v", expectedEnv, node.Env)
+	}
+	if token := node.RuntimeLabels[types.LabelClusterToken]; token != "new" {
+		t.Errorf("expected token label new, got %s", token)
+	}
+	if len(node.HookActions) != 1 {
+		t.Fatalf("expected a hook writing the token config, got %d hooks", len(node.HookActions))
+	}
+	if action := node.HookActions[0].Action.(actions.WriteFileAction); action.Dest != k3sTokenConfigPath || string(action.Content) != "token: new\n" {
+		t.Errorf("unexpected token config %s: %q", action.Dest, action.Content)
+	}
+
+	node = &types.Node{}
+	if err := setNodeToken(newFakeRuntime(), node, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(node.Env, []string{"K3S_TOKEN=new"}) {
+		t.Errorf("expected token env to be added, got %v", node.Env)
+	}
+}
+
+func TestTokenConfig(t *testing.T) {
+	config, err := tokenConfig("foo: bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "token: 'foo: bar'\n"; string(config) != expected {
+		t.Errorf("expected %q, got %q", expected, config)
+	}
+}
+
+func TestRotateClusterToken(t *testing.T) {
+	var output bytes.Buffer
+
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	installK3dLogHook(ctx)
+	ctx, done := k3dLogScope(ctx)
+	defer done()
+
+	runtime := newFakeRuntime()
+	for _, node := range []*types.Node{
+		{Name: "k3d-foo-server-0", Role: types.ServerRole, RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: "server"}},
+		{Name: "k3d-foo-agent-0", Role: types.AgentRole, RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: "agent"}},
+	} {
+		if err := runtime.CreateNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rotateClusterToken(ctx, runtime, "foo", "old-rotated-token", "new-rotated-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCmd := []string{"k3s", "token", "rotate", "--token", "old-rotated-token", "--new-token", "new-rotated-token"}
+	if !reflect.DeepEqual(runtime.execs["k3d-foo-server-0"], [][]string{expectedCmd}) {
+		t.Errorf("unexpected commands: %v", runtime.execs)
+	}
+	for _, name := range []string{"k3d-foo-server-0", "k3d-foo-agent-0"} {
+		if content := string(runtime.files[name][k3sTokenConfigPath]); content != "token: new-rotated-token\n" {
+			t.Errorf("%s: unexpected token config %q", name, content)
+		}
+	}
+
+	logs := output.String()
+	if !strings.Contains(logs, "Executing command") {
+		t.Errorf("expected the command to be logged, got %s", logs)
+	}
+	if strings.Contains(logs, "rotated-token") {
+		t.Errorf("expected the tokens to be masked, got %s", logs)
+	}
+}
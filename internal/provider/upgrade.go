@@ -0,0 +1,613 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+const (
+	upgradeStrategyRecreate = "recreate"
+	upgradeStrategyRolling  = "rolling"
+
+	// minRollingUpgradeServers is the smallest number of servers keeping
+	// etcd quorum while one of them is being replaced.
+	minRollingUpgradeServers = 3
+)
+
+// rollingUpgradeCluster replaces the nodes created along with the cluster, one
+// at a time, with nodes running image: servers first, then agents. Each node
+// is drained beforehand and has to be Ready again before moving on to the next
+// one, draining and getting Ready each have to complete within timeout. Nodes already running image are skipped, so that a
+// failed upgrade can be resumed.
+func rollingUpgradeCluster(ctx context.Context, runtime runtimes.Runtime, clusterName string, servers int, agents int, image string, memory map[types.Role]string, files []v1alpha5.FileWithNodeFilters, timeout time.Duration) error {
+	cluster, err := client.ClusterGet(ctx, runtime, &types.Cluster{Name: clusterName})
+	if err != nil {
+		return err
+	}
+
+	kubeconfig, err := client.KubeconfigGet(ctx, runtime, cluster)
+	if err != nil {
+		return err
+	}
+	restConfig, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	envInfo, err := client.GatherEnvironmentInfo(ctx, runtime, cluster)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]*types.Node, len(cluster.Nodes))
+	for _, node := range cluster.Nodes {
+		nodes[node.Name] = node
+	}
+
+	nodeFiles, err := resolveNodeFiles(cluster.Nodes, files)
+	if err != nil {
+		return err
+	}
+
+	// the containers still carry the token the cluster was created with
+	token, err := getClusterToken(ctx, runtime, cluster)
+	if err != nil {
+		return err
+	}
+
+	serverNames := make([]string, 0, servers)
+	for i := 0; i < servers; i++ {
+		serverNames = append(serverNames, client.GenerateNodeName(clusterName, types.ServerRole, i))
+	}
+	agentNames := make([]string, 0, agents)
+	for i := 0; i < agents; i++ {
+		agentNames = append(agentNames, client.GenerateNodeName(clusterName, types.AgentRole, i))
+	}
+
+	for _, name := range append(serverNames, agentNames...) {
+		node, ok := nodes[name]
+		if !ok {
+			return fmt.Errorf("node '%s' of cluster '%s' not found", name, clusterName)
+		}
+
+		current, err := getNodeImage(ctx, runtime, node)
+		if err != nil {
+			return err
+		}
+		if current == image {
+			tflog.Debug(ctx, "Node already upgraded, skipping", map[string]interface{}{"node": name})
+			continue
+		}
+
+		newNode, err := newUpgradedNode(ctx, runtime, node, image, memory[node.Role], envInfo, nodeFiles[name])
+		if err != nil {
+			return err
+		}
+		if err := setNodeToken(runtime, newNode, token); err != nil {
+			return err
+		}
+
+		tflog.Info(ctx, "Upgrading node", map[string]interface{}{"node": name, "image": image})
+
+		if err := drainNode(ctx, clientset, name, timeout); err != nil {
+			return fmt.Errorf("failed to drain node '%s': %w", name, err)
+		}
+
+		ready := func(ctx context.Context, started time.Time) error {
+			if err := waitForNodeReady(ctx, clientset, name, started, timeout); err != nil {
+				return fmt.Errorf("node '%s' failed to get ready: %w", name, err)
+			}
+			return nil
+		}
+		if err := replaceNode(ctx, runtime, node, newNode, envInfo, ready); err != nil {
+			return err
+		}
+
+		if err := uncordonNode(ctx, clientset, name); err != nil {
+			return fmt.Errorf("failed to uncordon node '%s': %w", name, err)
+		}
+
+		if node.Role == types.ServerRole && cluster.ServerLoadBalancer != nil {
+			if err := client.UpdateLoadbalancerConfig(ctx, runtime, cluster); err != nil && !errors.Is(err, client.ErrLBConfigHostNotFound) {
+				return fmt.Errorf("error updating loadbalancer: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// replaceNode swaps node for newNode like client.NodeReplace does, but also
+// hands the environment info over to the new node. NodeReplace starts the new
+// node without it, and k3d's DNS fix, enabled by default, then fails with
+// "Cannot enable DNS fix, as Host Gateway IP is missing!".
+//
+// newNode takes over the state of node once node is stopped, so that it comes
+// back as the same kubernetes node and etcd member instead of joining anew.
+// node is only deleted once newNode has started and ready, if not nil, returns
+// no error given the time newNode was started at. Otherwise newNode is deleted
+// and node is started again.
+func replaceNode(ctx context.Context, runtime runtimes.Runtime, node *types.Node, newNode *types.Node, envInfo *types.EnvironmentInfo, ready func(ctx context.Context, started time.Time) error) error {
+	name := node.Name
+	tmpName := fmt.Sprintf("%s-%s", name, util.GenerateRandomString(5))
+	if err := runtime.RenameNode(ctx, node, tmpName); err != nil {
+		return fmt.Errorf("failed to rename node '%s': %w", name, err)
+	}
+	node.Name = tmpName
+
+	// bring the old node back on failure
+	rollback := func(err error) error {
+		if deleteErr := client.NodeDelete(ctx, runtime, newNode, types.NodeDeleteOpts{SkipLBUpdate: true}); deleteErr != nil {
+			return fmt.Errorf("%w, also failed to delete new node: %s", err, deleteErr)
+		}
+		if renameErr := runtime.RenameNode(ctx, node, name); renameErr != nil {
+			return fmt.Errorf("%w, also failed to rename node '%s' back to '%s': %s", err, tmpName, name, renameErr)
+		}
+		node.Name = name
+		node.State.Running = false
+		if startErr := client.NodeStart(ctx, runtime, node, &types.NodeStartOpts{Wait: true, EnvironmentInfo: envInfo}); startErr != nil {
+			return fmt.Errorf("%w, also failed to restart node '%s': %s", err, name, startErr)
+		}
+		return err
+	}
+
+	if err := client.NodeCreate(ctx, runtime, newNode, types.NodeCreateOpts{Wait: true}); err != nil {
+		if renameErr := runtime.RenameNode(ctx, node, name); renameErr != nil {
+			return fmt.Errorf("failed to create node '%s': %w, also failed to rename node '%s' back: %s", name, err, tmpName, renameErr)
+		}
+		node.Name = name
+		return fmt.Errorf("failed to create node '%s': %w", name, err)
+	}
+
+	if err := runtime.StopNode(ctx, node); err != nil {
+		return rollback(fmt.Errorf("failed to stop node '%s': %w", tmpName, err))
+	}
+
+	if err := copyNodeState(ctx, runtime, node, newNode); err != nil {
+		return rollback(fmt.Errorf("failed to copy the state of node '%s': %w", name, err))
+	}
+
+	// heartbeats are reported to the second
+	started := time.Now().Truncate(time.Second)
+	if err := client.NodeStart(ctx, runtime, newNode, &types.NodeStartOpts{Wait: true, NodeHooks: newNode.HookActions, EnvironmentInfo: envInfo}); err != nil {
+		return rollback(fmt.Errorf("failed to start node '%s': %w", name, err))
+	}
+
+	if ready != nil {
+		if err := ready(ctx, started); err != nil {
+			return rollback(err)
+		}
+	}
+
+	if err := client.NodeDelete(ctx, runtime, node, types.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+		return fmt.Errorf("failed to delete old node '%s': %w", tmpName, err)
+	}
+
+	return nil
+}
+
+// nodeStatePaths returns the paths holding the identity of a node of role in
+// the cluster: its node password and, for servers, the k3s server data, etcd
+// included.
+func nodeStatePaths(role types.Role) []string {
+	paths := []string{"/etc/rancher/node/password"}
+	if role == types.ServerRole {
+		paths = append(paths, "/var/lib/rancher/k3s/server")
+	}
+
+	return paths
+}
+
+// copyNodeState copies the state of node, which has to be stopped for its
+// datastore to be consistent, into newNode. Missing paths are skipped.
+func copyNodeState(ctx context.Context, runtime runtimes.Runtime, node *types.Node, newNode *types.Node) error {
+	dir, err := os.MkdirTemp("", "k3d-node-state-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range nodeStatePaths(node.Role) {
+		reader, err := runtime.ReadFromNode(ctx, path, node)
+		if errors.Is(err, runtimeErrors.ErrRuntimeFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = extractTar(reader, dir)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' from node '%s': %w", path, node.Name, err)
+		}
+
+		src := filepath.Join(dir, filepath.Base(path))
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+
+		// the parent directory of a file may not exist yet in the new node
+		if !info.IsDir() {
+			content, err := os.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			err = runtime.WriteToNode(ctx, content, path, info.Mode().Perm(), newNode)
+		} else {
+			err = runtime.CopyToNode(ctx, src, filepath.Dir(path), newNode)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write '%s' to node '%s': %w", path, newNode.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// extractTar extracts the directories, regular files and symlinks of the tar
+// archive read from reader into dir.
+func extractTar(reader io.Reader, dir string) error {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid path '%s' in archive", header.Name)
+		}
+		target := filepath.Join(dir, header.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, archive)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resolveNodeFiles returns the files to write into each node, by node name,
+// the way k3d does when creating the cluster.
+func resolveNodeFiles(nodes []*types.Node, files []v1alpha5.FileWithNodeFilters) (map[string][]types.File, error) {
+	nodeFiles := make(map[string][]types.File, len(nodes))
+	for _, file := range files {
+		filtered, err := util.FilterNodes(nodes, file.NodeFilters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter nodes for file '%s': %w", file.Destination, err)
+		}
+
+		content, err := util.ReadFileSource("", file.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source content: %w", err)
+		}
+
+		destination, err := util.ResolveFileDestination(file.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("destination path is not correct: %w", err)
+		}
+
+		for _, node := range filtered {
+			nodeFiles[node.Name] = append(nodeFiles[node.Name], types.File{
+				Content:     content,
+				Destination: destination,
+				Description: file.Description,
+			})
+		}
+	}
+
+	return nodeFiles, nil
+}
+
+// newUpgradedNode returns the spec of the node replacing node with the given
+// image and memory limit, writing files into it like at cluster creation.
+func newUpgradedNode(ctx context.Context, runtime runtimes.Runtime, node *types.Node, image string, memory string, envInfo *types.EnvironmentInfo, files []types.File) (*types.Node, error) {
+	newNode, err := client.CopyNode(ctx, node, client.CopyNodeOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	newNode.Image = image
+	newNode.Memory = memory
+
+	// k3d only reports its own labels, keep the user defined ones as well
+	if newNode.RuntimeLabels, err = getNodeRuntimeLabels(ctx, runtime, node); err != nil {
+		return nil, err
+	}
+
+	// the fake meminfo is mounted again by k3d according to the memory limit
+	newNode.Volumes = make([]string, 0, len(node.Volumes))
+	for _, volume := range node.Volumes {
+		if !isFakeMemoryVolume(volume) {
+			newNode.Volumes = append(newNode.Volumes, volume)
+		}
+	}
+
+	for _, file := range files {
+		newNode.HookActions = append(newNode.HookActions, types.NodeHook{
+			Stage: types.LifecycleStagePreStart,
+			Action: actions.WriteFileAction{
+				Runtime:     runtime,
+				Content:     file.Content,
+				Dest:        file.Destination,
+				Mode:        0644,
+				Description: file.Description,
+			},
+		})
+	}
+
+	hooks, err := copyNodeHooks(ctx, runtime, node, envInfo)
+	if err != nil {
+		return nil, err
+	}
+	newNode.HookActions = append(newNode.HookActions, hooks...)
+
+	return newNode, nil
+}
+
+// copyNodeHooks returns the hooks carrying over what k3d writes into the node
+// containers besides their spec: the registry config, the host aliases and the
+// host record of the host gateway. They are read from node, as k3d does when
+// adding nodes.
+func copyNodeHooks(ctx context.Context, runtime runtimes.Runtime, node *types.Node, envInfo *types.EnvironmentInfo) ([]types.NodeHook, error) {
+	var hooks []types.NodeHook
+
+	registryConfig, err := readNodeFile(ctx, runtime, node, types.DefaultRegistriesFilePath)
+	if err != nil {
+		if !errors.Is(err, runtimeErrors.ErrRuntimeFileNotFound) {
+			return nil, fmt.Errorf("failed to read registry config from node '%s': %w", node.Name, err)
+		}
+	} else {
+		hooks = append(hooks, types.NodeHook{
+			Stage: types.LifecycleStagePreStart,
+			Action: actions.WriteFileAction{
+				Runtime:     runtime,
+				Content:     registryConfig,
+				Dest:        types.DefaultRegistriesFilePath,
+				Mode:        0644,
+				Description: "Write Registry Configuration",
+			},
+		})
+	}
+
+	hook, err := hostAliasesHook(runtime, node)
+	if err != nil {
+		return nil, err
+	}
+	if hook != nil {
+		hooks = append(hooks, *hook)
+	}
+
+	if envInfo.HostGateway.IsValid() && node.RuntimeLabels[types.LabelNetwork] != "host" {
+		hooks = append(hooks, types.NodeHook{
+			Stage: types.LifecycleStagePostStart,
+			Action: actions.ExecAction{
+				Runtime: runtime,
+				Command: []string{
+					"sh", "-c",
+					fmt.Sprintf("echo '%s %s' >> /etc/hosts", envInfo.HostGateway.String(), types.DefaultK3dInternalHostRecord),
+				},
+				Description: fmt.Sprintf("Inject /etc/hosts record for %s", types.DefaultK3dInternalHostRecord),
+			},
+		})
+	}
+
+	return hooks, nil
+}
+
+// hostAliasesHook returns the hook injecting the host aliases of node, nil if
+// it has none. They are kept in a label for k3d to inject them on cluster
+// start.
+func hostAliasesHook(runtime runtimes.Runtime, node *types.Node) (*types.NodeHook, error) {
+	hostAliasesJSON, ok := node.RuntimeLabels[types.LabelClusterStartHostAliases]
+	if !ok {
+		return nil, nil
+	}
+
+	var hostAliases []types.HostAlias
+	if err := json.Unmarshal([]byte(hostAliasesJSON), &hostAliases); err != nil {
+		return nil, fmt.Errorf("failed to read host aliases of node '%s': %w", node.Name, err)
+	}
+
+	return &types.NodeHook{
+		Stage:  types.LifecycleStagePostStart,
+		Action: client.NewHostAliasesInjectEtcHostsAction(runtime, hostAliases),
+	}, nil
+}
+
+// getNodeRuntimeLabels returns all the runtime labels of the node, of which
+// runtimes may report the k3d ones only.
+func getNodeRuntimeLabels(ctx context.Context, runtime runtimes.Runtime, node *types.Node) (map[string]string, error) {
+	if r, ok := asProviderRuntime(runtime); ok {
+		return r.GetNodeRuntimeLabels(ctx, node)
+	}
+
+	return node.RuntimeLabels, nil
+}
+
+// drainNode cordons the node and evicts its pods, except for the ones managed
+// by a DaemonSet or the kubelet, waiting up to timeout for them to be gone.
+func drainNode(ctx context.Context, clientset kubernetes.Interface, nodeName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !node.Spec.Unschedulable {
+		node.Spec.Unschedulable = true
+		if _, err := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to cordon node: %w", err)
+		}
+	}
+
+	pods, err := listEvictablePods(ctx, clientset, nodeName)
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		eviction := &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}
+		err := wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+			err := clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+				return true, nil
+			case apierrors.IsTooManyRequests(err):
+				// blocked by a PodDisruptionBudget, retry
+				tflog.Debug(ctx, "Pod eviction blocked, retrying", map[string]interface{}{"pod": pod.Namespace + "/" + pod.Name})
+				return false, nil
+			default:
+				return false, err
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to evict pod '%s/%s': %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	return wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		pods, err := listEvictablePods(ctx, clientset, nodeName)
+		if err != nil {
+			return false, err
+		}
+
+		return len(pods) == 0, nil
+	})
+}
+
+// listEvictablePods returns the pods running on the node that have to be
+// evicted to drain it.
+func listEvictablePods(ctx context.Context, clientset kubernetes.Interface, nodeName string) ([]corev1.Pod, error) {
+	list, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]corev1.Pod, 0, len(list.Items))
+	for _, pod := range list.Items {
+		if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror {
+			continue
+		}
+		if controller := metav1.GetControllerOf(&pod); controller != nil && controller.Kind == "DaemonSet" {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+
+	return pods, nil
+}
+
+// uncordonNode marks the node as schedulable again.
+func uncordonNode(ctx context.Context, clientset kubernetes.Interface, nodeName string) error {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !node.Spec.Unschedulable {
+		return nil
+	}
+
+	node.Spec.Unschedulable = false
+	_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+	return err
+}
+
+// waitForNodeReady waits up to timeout for the node to be registered and
+// Ready, as reported by a kubelet heartbeat from since on. The node keeps
+// the status last reported by a replaced container until then.
+func waitForNodeReady(ctx context.Context, clientset kubernetes.Interface, nodeName string, since time.Time, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady {
+				return condition.Status == corev1.ConditionTrue && !condition.LastHeartbeatTime.Time.Before(since), nil
+			}
+		}
+
+		return false, nil
+	})
+}
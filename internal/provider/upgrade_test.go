@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestDrainNode(t *testing.T) {
+	isController := true
+	pod := func(name string, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+
+	daemon := pod("daemon", "k3d-foo-agent-0")
+	daemon.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "daemon", Controller: &isController}}
+	mirror := pod("mirror", "k3d-foo-agent-0")
+	mirror.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "mirror"}
+	done := pod("done", "k3d-foo-agent-0")
+	done.Status.Phase = corev1.PodSucceeded
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "k3d-foo-agent-0"}},
+		pod("app", "k3d-foo-agent-0"),
+		daemon,
+		mirror,
+		done,
+	)
+
+	// the fake clientset doesn't implement evictions
+	evicted := []string{}
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		name := action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+		evicted = append(evicted, name)
+		return true, nil, clientset.Tracker().Delete(action.GetResource(), action.GetNamespace(), name)
+	})
+
+	if err := drainNode(context.Background(), clientset, "k3d-foo-agent-0", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "k3d-foo-agent-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Spec.Unschedulable {
+		t.Errorf("expected node to be cordoned")
+	}
+
+	if len(evicted) != 1 || evicted[0] != "app" {
+		t.Errorf("expected only pod app to be evicted, got %v", evicted)
+	}
+}
+
+func TestDrainNode_notFound(t *testing.T) {
+	if err := drainNode(context.Background(), fake.NewSimpleClientset(), "k3d-foo-agent-0", time.Minute); err != nil {
+		t.Errorf("expected missing node to be ignored, got %s", err)
+	}
+}
+
+func TestWaitForNodeReady(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "k3d-foo-server-0"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	})
+
+	if err := waitForNodeReady(context.Background(), clientset, "k3d-foo-server-0", time.Time{}, time.Minute); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWaitForNodeReady_staleHeartbeat(t *testing.T) {
+	heartbeat := time.Now().Truncate(time.Second)
+	clientset := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "k3d-foo-server-0"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(heartbeat)}},
+		},
+	})
+
+	// the status left by the replaced container doesn't count
+	err := waitForNodeReady(context.Background(), clientset, "k3d-foo-server-0", heartbeat.Add(time.Second), 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+
+	if err := waitForNodeReady(context.Background(), clientset, "k3d-foo-server-0", heartbeat, time.Minute); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWaitForNodeReady_timeout(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "k3d-foo-server-0"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}},
+		},
+	})
+
+	err := waitForNodeReady(context.Background(), clientset, "k3d-foo-server-0", time.Time{}, 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+}
+
+func TestUncordonNode(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "k3d-foo-agent-0"},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+	})
+
+	if err := uncordonNode(context.Background(), clientset, "k3d-foo-agent-0"); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "k3d-foo-agent-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Spec.Unschedulable {
+		t.Errorf("expected node to be schedulable")
+	}
+}
+
+// testReplacedServer creates a running server of cluster foo in runtime,
+// holding its node password and etcd data.
+func testReplacedServer(t *testing.T, runtime *fakeRuntime) (*types.Node, *types.Node) {
+	t.Helper()
+
+	ctx := context.Background()
+	node := &types.Node{
+		Name:          "k3d-foo-server-0",
+		Role:          types.ServerRole,
+		Image:         "rancher/k3s:v1.30.4-k3s1",
+		RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: string(types.ServerRole)},
+	}
+	if err := runtime.CreateNode(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.StartNode(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"/etc/rancher/node/password":                 "password",
+		"/var/lib/rancher/k3s/server/token":          "token",
+		"/var/lib/rancher/k3s/server/db/etcd/name":   "k3d-foo-server-0-1234",
+		"/var/lib/rancher/k3s/server/db/etcd/member": "member",
+		"/var/lib/rancher/k3s/agent/client-ca.crt":   "agent",
+	} {
+		if err := runtime.WriteToNode(ctx, []byte(content), path, 0600, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newNode := &types.Node{
+		Name:          node.Name,
+		Role:          node.Role,
+		Image:         "rancher/k3s:v1.31.0-k3s1",
+		RuntimeLabels: map[string]string{types.LabelClusterName: "foo", types.LabelRole: string(types.ServerRole)},
+		ServerOpts:    types.ServerOpts{KubeAPI: &types.ExposureOpts{Host: "0.0.0.0"}},
+	}
+
+	return node, newNode
+}
+
+func TestReplaceNode(t *testing.T) {
+	runtime := newFakeRuntime()
+	node, newNode := testReplacedServer(t, runtime)
+
+	var started time.Time
+	ready := func(_ context.Context, at time.Time) error {
+		started = at
+		return nil
+	}
+	envInfo := &types.EnvironmentInfo{HostGateway: netip.MustParseAddr("172.17.0.1")}
+	if err := replaceNode(context.Background(), runtime, node, newNode, envInfo, ready); err != nil {
+		t.Fatal(err)
+	}
+
+	if started.IsZero() {
+		t.Errorf("expected ready to be called")
+	}
+
+	replaced := runtime.node("k3d-foo-server-0")
+	if replaced == nil || replaced.Image != "rancher/k3s:v1.31.0-k3s1" || !replaced.State.Running {
+		t.Fatalf("expected the new node to be running, got %+v", replaced)
+	}
+	if runtime.node(node.Name) != nil {
+		t.Errorf("expected the old node %s to be deleted", node.Name)
+	}
+
+	// the identity of the node is carried over, not the agent data
+	for path, content := range map[string]string{
+		"/etc/rancher/node/password":               "password",
+		"/var/lib/rancher/k3s/server/token":        "token",
+		"/var/lib/rancher/k3s/server/db/etcd/name": "k3d-foo-server-0-1234",
+	} {
+		if got := string(runtime.files["k3d-foo-server-0"][path]); got != content {
+			t.Errorf("expected %s to hold %q, got %q", path, content, got)
+		}
+	}
+	if _, ok := runtime.files["k3d-foo-server-0"]["/var/lib/rancher/k3s/agent/client-ca.crt"]; ok {
+		t.Errorf("expected the agent data not to be copied")
+	}
+}
+
+func TestReplaceNode_notReady(t *testing.T) {
+	runtime := newFakeRuntime()
+	node, newNode := testReplacedServer(t, runtime)
+
+	ready := func(context.Context, time.Time) error {
+		return errors.New("not ready")
+	}
+	envInfo := &types.EnvironmentInfo{HostGateway: netip.MustParseAddr("172.17.0.1")}
+	err := replaceNode(context.Background(), runtime, node, newNode, envInfo, ready)
+	if err == nil || err.Error() != "not ready" {
+		t.Fatalf("expected the readiness error, got %v", err)
+	}
+
+	// the old node is back, data included
+	restored := runtime.node("k3d-foo-server-0")
+	if restored == nil || restored.Image != "rancher/k3s:v1.30.4-k3s1" || !restored.State.Running {
+		t.Fatalf("expected the old node to be running again, got %+v", restored)
+	}
+	if node.Name != "k3d-foo-server-0" {
+		t.Errorf("expected the old node to get its name back, got %s", node.Name)
+	}
+	if got := string(runtime.files["k3d-foo-server-0"]["/var/lib/rancher/k3s/agent/client-ca.crt"]); got != "agent" {
+		t.Errorf("expected the old node to keep its data, got %q", got)
+	}
+	if len(runtime.nodes) != 1 {
+		t.Errorf("expected the new node to be deleted, got %d nodes", len(runtime.nodes))
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"flag"
 	"log"
 
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6/tf6server"
 	"github.com/pvotal-tech/terraform-provider-k3d/internal/provider"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 )
 
 // Run "go generate" to format example terraform files and generate the docs for the registry/website
@@ -34,15 +34,18 @@ func main() {
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
-	opts := &plugin.ServeOpts{ProviderFunc: provider.New(version)}
+	serverFactory, err := provider.NewMuxServer(context.Background(), version)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
+	var opts []tf6server.ServeOpt
 	if debugMode {
-		err := plugin.Debug(context.Background(), "registry.terraform.io/providers/pvotal-tech/k3d", opts)
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		return
+		opts = append(opts, tf6server.WithManagedDebug())
 	}
 
-	plugin.Serve(opts)
+	err = tf6server.Serve("registry.terraform.io/providers/pvotal-tech/k3d", serverFactory, opts...)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 }